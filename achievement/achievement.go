@@ -0,0 +1,259 @@
+package achievement
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Achievement struct {
+	Code        string
+	Name        string
+	Description string
+	Icon        string
+	Events      []string
+	Query       string
+	Threshold   int
+}
+
+type UnlockedAchievement struct {
+	Achievement
+	UnlockedAt time.Time
+}
+
+// Chaque regle est une requete qui compte, pour un joueur (unique parametre ?),
+// le nombre d'actions realisees. Le badge est debloque quand Threshold est atteint.
+var Achievements = []Achievement{
+	{
+		Code:        "first_win",
+		Name:        "Premiere victoire",
+		Description: "Gagner une partie",
+		Icon:        "🏆",
+		Events:      []string{"game_end"},
+		Query:       winsQuery,
+		Threshold:   1,
+	},
+	{
+		Code:        "ten_wins",
+		Name:        "Habitue du podium",
+		Description: "Gagner 10 parties",
+		Icon:        "👑",
+		Events:      []string{"game_end"},
+		Query:       winsQuery,
+		Threshold:   10,
+	},
+	{
+		Code:        "quick_ear",
+		Name:        "Oreille absolue",
+		Description: "Trouver 10 morceaux en moins de 2 secondes au Blind Test",
+		Icon:        "⚡",
+		Events:      []string{"round_end"},
+		Query: `
+			SELECT COUNT(*)
+			FROM blindtest_guesses
+			WHERE user_id = ? AND points > 0 AND elapsed_ms < 2000
+		`,
+		Threshold: 10,
+	},
+	{
+		Code:        "music_library",
+		Name:        "Discotheque",
+		Description: "Trouver 100 morceaux au Blind Test",
+		Icon:        "💿",
+		Events:      []string{"round_end"},
+		Query: `
+			SELECT COUNT(*)
+			FROM blindtest_guesses
+			WHERE user_id = ? AND points > 0
+		`,
+		Threshold: 100,
+	},
+	{
+		Code:        "perfect_round",
+		Name:        "Sans faute",
+		Description: "Faire une manche parfaite au Petit Bac (5 reponses uniques validees)",
+		Icon:        "✨",
+		Events:      []string{"round_end"},
+		Query: `
+			SELECT COUNT(*)
+			FROM scores
+			WHERE user_id = ? AND game_type = 'petitbac' AND score >= 10
+		`,
+		Threshold: 1,
+	},
+	{
+		Code:        "host_20",
+		Name:        "Maitre de ceremonie",
+		Description: "Heberger 20 parties",
+		Icon:        "🎤",
+		Events:      []string{"game_end"},
+		Query: `
+			SELECT COUNT(*)
+			FROM rooms
+			WHERE host_id = ? AND status = 'finished'
+		`,
+		Threshold: 20,
+	},
+	{
+		Code:        "games_50",
+		Name:        "Pilier de la salle",
+		Description: "Jouer 50 parties",
+		Icon:        "🎶",
+		Events:      []string{"game_end"},
+		Query: `
+			SELECT COUNT(*)
+			FROM room_players rp
+			JOIN rooms r ON r.id = rp.room_id
+			WHERE rp.user_id = ? AND r.status = 'finished'
+		`,
+		Threshold: 50,
+	},
+}
+
+const winsQuery = `
+	WITH totals AS (
+		SELECT rp.room_id, rp.user_id, COALESCE(SUM(s.score), 0) AS total
+		FROM room_players rp
+		JOIN rooms r ON r.id = rp.room_id AND r.status = 'finished'
+		LEFT JOIN scores s ON s.room_id = rp.room_id AND s.user_id = rp.user_id
+		GROUP BY rp.room_id, rp.user_id
+	)
+	SELECT COUNT(*)
+	FROM totals t
+	WHERE t.user_id = ? AND t.total > 0
+		AND t.total >= (SELECT MAX(total) FROM totals WHERE room_id = t.room_id)
+`
+
+func GetAchievement(code string) (Achievement, bool) {
+	for _, achievement := range Achievements {
+		if achievement.Code == code {
+			return achievement, true
+		}
+	}
+	return Achievement{}, false
+}
+
+func listensTo(achievement Achievement, event string) bool {
+	for _, e := range achievement.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Evalue les regles associees a l'evenement et retourne les badges nouvellement debloques
+func Evaluate(db *sql.DB, userID int, event string) ([]Achievement, error) {
+	unlocked, err := getUnlockedCodes(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var newlyUnlocked []Achievement
+	for _, achievement := range Achievements {
+		if unlocked[achievement.Code] || !listensTo(achievement, event) {
+			continue
+		}
+
+		var count int
+		if err := db.QueryRow(achievement.Query, userID).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count < achievement.Threshold {
+			continue
+		}
+
+		result, err := db.Exec(`
+			INSERT INTO user_achievements (user_id, achievement_code)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+		`, userID, achievement.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			newlyUnlocked = append(newlyUnlocked, achievement)
+		}
+	}
+
+	return newlyUnlocked, nil
+}
+
+func getUnlockedCodes(db *sql.DB, userID int) (map[string]bool, error) {
+	rows, err := db.Query("SELECT achievement_code FROM user_achievements WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := make(map[string]bool)
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes[code] = true
+	}
+
+	return codes, nil
+}
+
+func GetUserAchievements(db *sql.DB, userID int) ([]UnlockedAchievement, error) {
+	rows, err := db.Query(`
+		SELECT achievement_code, unlocked_at
+		FROM user_achievements
+		WHERE user_id = ?
+		ORDER BY unlocked_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var achievements []UnlockedAchievement
+	for rows.Next() {
+		var code string
+		var unlockedAt time.Time
+		if err := rows.Scan(&code, &unlockedAt); err != nil {
+			return nil, err
+		}
+
+		// Un badge retire des regles reste en base mais n'est plus affiche
+		achievement, ok := GetAchievement(code)
+		if !ok {
+			continue
+		}
+		achievements = append(achievements, UnlockedAchievement{Achievement: achievement, UnlockedAt: unlockedAt})
+	}
+
+	return achievements, nil
+}
+
+func GetRoomAchievements(db *sql.DB, roomID int) (map[int][]Achievement, error) {
+	rows, err := db.Query(`
+		SELECT ua.user_id, ua.achievement_code
+		FROM user_achievements ua
+		JOIN room_players rp ON rp.user_id = ua.user_id
+		WHERE rp.room_id = ?
+		ORDER BY ua.unlocked_at ASC
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	achievements := make(map[int][]Achievement)
+	for rows.Next() {
+		var userID int
+		var code string
+		if err := rows.Scan(&userID, &code); err != nil {
+			return nil, err
+		}
+
+		if achievement, ok := GetAchievement(code); ok {
+			achievements[userID] = append(achievements[userID], achievement)
+		}
+	}
+
+	return achievements, nil
+}
@@ -0,0 +1,220 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type User struct {
+	ID        int
+	Pseudo    string
+	Email     string
+	Role      string
+	IsGuest   bool
+	Banned    bool
+	BanReason string
+	CreatedAt time.Time
+}
+
+type Report struct {
+	ID             int
+	ReporterPseudo string
+	ReportedID     int
+	ReportedPseudo string
+	Reason         string
+	CreatedAt      time.Time
+	Resolved       bool
+}
+
+type RoomInfo struct {
+	ID       int
+	Code     string
+	GameType string
+	Status   string
+	Host     string
+}
+
+const maxReasonLength = 500
+
+// Liste les comptes (hors comptes supprimes), filtres par pseudo ou email
+func ListUsers(db *sql.DB, search string, limit int) ([]User, error) {
+	pattern := "%" + strings.ToLower(search) + "%"
+
+	rows, err := db.Query(`
+		SELECT id, pseudo, email, role, is_guest, banned_at IS NOT NULL, COALESCE(ban_reason, ''), created_at
+		FROM users
+		WHERE deleted_at IS NULL AND (LOWER(pseudo) LIKE ? OR LOWER(email) LIKE ?)
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, pattern, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		err := rows.Scan(&u.ID, &u.Pseudo, &u.Email, &u.Role, &u.IsGuest, &u.Banned, &u.BanReason, &u.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, nil
+}
+
+func GetUserRole(db *sql.DB, userID int) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = ? AND deleted_at IS NULL", userID).Scan(&role)
+	if err != nil {
+		return "", errors.New("utilisateur introuvable")
+	}
+	return role, nil
+}
+
+// Suspend le compte et ferme toutes ses sessions
+func BanUser(db *sql.DB, userID int, reason string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET banned_at = ?, ban_reason = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, time.Now().UTC(), TruncateReason(reason), userID)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errors.New("utilisateur introuvable")
+	}
+
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func UnbanUser(db *sql.DB, userID int) error {
+	_, err := db.Exec("UPDATE users SET banned_at = NULL, ban_reason = NULL WHERE id = ?", userID)
+	return err
+}
+
+func SetRole(db *sql.DB, userID int, role string) error {
+	result, err := db.Exec("UPDATE users SET role = ? WHERE id = ? AND deleted_at IS NULL AND is_guest = 0", role, userID)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errors.New("utilisateur introuvable")
+	}
+	return nil
+}
+
+// Donne le role admin au compte indique (premier administrateur)
+func PromoteAdmin(db *sql.DB, pseudo string) error {
+	result, err := db.Exec("UPDATE users SET role = 'admin' WHERE pseudo = ? AND deleted_at IS NULL AND is_guest = 0", pseudo)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errors.New("utilisateur introuvable")
+	}
+	return nil
+}
+
+// Retourne la raison a enregistrer, nettoyee et tronquee
+func CheckReport(reporterID int, reportedID int, reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return "", errors.New("indique la raison du signalement")
+	}
+	if reporterID == reportedID {
+		return "", errors.New("tu ne peux pas te signaler toi-meme")
+	}
+	return TruncateReason(reason), nil
+}
+
+func CreateReport(db *sql.DB, reporterID int, reportedID int, reason string) error {
+	reason, err := CheckReport(reporterID, reportedID, reason)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO reports (reporter_id, reported_user_id, reason)
+		VALUES (?, ?, ?)
+	`, reporterID, reportedID, reason)
+	return err
+}
+
+func GetRecentReports(db *sql.DB, limit int) ([]Report, error) {
+	rows, err := db.Query(`
+		SELECT r.id, reporter.pseudo, r.reported_user_id, reported.pseudo, r.reason, r.created_at, r.resolved_at IS NOT NULL
+		FROM reports r
+		JOIN users reporter ON reporter.id = r.reporter_id
+		JOIN users reported ON reported.id = r.reported_user_id
+		ORDER BY r.resolved_at IS NOT NULL, r.created_at DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		var r Report
+		err := rows.Scan(&r.ID, &r.ReporterPseudo, &r.ReportedID, &r.ReportedPseudo, &r.Reason, &r.CreatedAt, &r.Resolved)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+
+	return reports, nil
+}
+
+func ResolveReport(db *sql.DB, reportID int, resolvedBy int) error {
+	_, err := db.Exec(`
+		UPDATE reports SET resolved_at = ?, resolved_by = ?
+		WHERE id = ? AND resolved_at IS NULL
+	`, time.Now().UTC(), resolvedBy, reportID)
+	return err
+}
+
+// Informations des salles actives du Hub
+func GetRoomsInfo(db *sql.DB, roomIDs []int) (map[int]RoomInfo, error) {
+	rooms := make(map[int]RoomInfo)
+
+	for _, roomID := range roomIDs {
+		var info RoomInfo
+		err := db.QueryRow(`
+			SELECT r.id, r.code, r.game_type, r.status, u.pseudo
+			FROM rooms r
+			JOIN users u ON u.id = r.host_id
+			WHERE r.id = ?
+		`, roomID).Scan(&info.ID, &info.Code, &info.GameType, &info.Status, &info.Host)
+		if err != nil {
+			return nil, err
+		}
+		rooms[roomID] = info
+	}
+
+	return rooms, nil
+}
+
+func TruncateReason(text string) string {
+	runes := []rune(text)
+	if len(runes) > maxReasonLength {
+		return string(runes[:maxReasonLength])
+	}
+	return text
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"groupie-tracker/mailer"
+)
+
+var ErrWrongPassword = errors.New("mot de passe actuel incorrect")
+var ErrEmailTaken = errors.New("cette adresse mail est deja utilisee")
+var ErrReauthRequired = errors.New("compte sans mot de passe : reconnecte-toi avec ton fournisseur d'identite pour confirmer")
+
+// Un compte cree via OIDC n'a pas de mot de passe. Pour lui, une connexion plus
+// recente que ce delai remplace la saisie du mot de passe actuel.
+var OIDCReauthWindow = 10 * time.Minute
+
+// Messages affiches sur la page du compte apres une modification
+var accountMessages = map[string]string{
+	"pseudo":   "Pseudo modifie.",
+	"email":    "Un lien de confirmation a ete envoye a la nouvelle adresse.",
+	"confirm":  "Nouvelle adresse mail confirmee.",
+	"password": "Mot de passe modifie, les autres appareils ont ete deconnectes.",
+	"convert":  "Compte cree ! Tes scores sont conserves. Confirme ton adresse mail avec le lien recu pour pouvoir te reconnecter.",
+}
+
+// Sans mot de passe, seul OIDC permet de se connecter : une session ouverte il y
+// a moins de OIDCReauthWindow prouve une connexion recente aupres du fournisseur
+func checkCurrentPassword(accounts Accounts, userID int, sessionID int, password string) error {
+	user, err := accounts.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.PasswordHash == "" {
+		sessions, err := accounts.Sessions.ListForUser(userID)
+		if err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			if session.ID == sessionID && time.Since(session.CreatedAt) <= OIDCReauthWindow {
+				return nil
+			}
+		}
+		return ErrReauthRequired
+	}
+
+	if !CheckPasswordOrDummy(password, user.PasswordHash) {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func ChangePseudo(users UserStore, userID int, pseudo string) error {
+	if err := ValidatePseudo(pseudo); err != nil {
+		return err
+	}
+
+	if err := users.CheckPseudoAvailable(pseudo, userID); err != nil {
+		return err
+	}
+
+	return users.SetPseudo(userID, pseudo)
+}
+
+// Enregistre la nouvelle adresse en attente de confirmation
+func RequestEmailChange(users UserStore, userID int, email string) error {
+	if err := ValidateEmail(email); err != nil {
+		return err
+	}
+
+	return users.SetPendingEmail(userID, email)
+}
+
+func ConfirmEmailChange(accounts Accounts, token string) error {
+	userID, err := accounts.EmailTokens.Consume(token, TokenChangeEmail)
+	if err != nil {
+		return err
+	}
+
+	return accounts.Users.ConfirmPendingEmail(userID)
+}
+
+// Change le mot de passe et deconnecte toutes les autres sessions
+func ChangePassword(accounts Accounts, userID int, keepSessionID int, password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := accounts.Users.SetPassword(userID, hashedPassword); err != nil {
+		return err
+	}
+	return accounts.Sessions.DeleteOthers(userID, keepSessionID)
+}
+
+// Anonymise le compte au lieu de supprimer la ligne : les scores, parties et salles
+// gardent leur reference vers users.id mais n'affichent plus rien de personnel
+func DeleteAccount(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Un mot de passe vide ne correspond a aucun hash bcrypt : plus aucune connexion possible
+	_, err = tx.Exec(`
+		UPDATE users
+		SET pseudo = ?, pseudo_key = NULL, email = ?, password_hash = '', email_verified = 0,
+			pending_email = NULL, deleted_at = ?
+		WHERE id = ?
+	`, fmt.Sprintf("Joueur supprime %d", userID), fmt.Sprintf("supprime-%d@invalid", userID), time.Now().UTC(), userID)
+	if err != nil {
+		return err
+	}
+
+	cleanup := []string{
+		"DELETE FROM sessions WHERE user_id = ?",
+		"DELETE FROM email_tokens WHERE user_id = ?",
+		"DELETE FROM user_identities WHERE user_id = ?",
+		"DELETE FROM user_achievements WHERE user_id = ?",
+		"UPDATE login_attempts SET user_id = NULL, identifier = '', ip_address = '' WHERE user_id = ?",
+	}
+	for _, query := range cleanup {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func AccountHandler(accounts Accounts, m mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := GetUserID(r)
+
+		if r.Method == "POST" {
+			updated, err := handleAccountAction(accounts, m, w, r, userID)
+			if err != nil {
+				status := http.StatusBadRequest
+				if err == ErrWrongPassword || err == ErrReauthRequired {
+					status = http.StatusForbidden
+				}
+				if err == ErrPseudoTaken {
+					status = http.StatusConflict
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			if updated == "" {
+				return
+			}
+
+			http.Redirect(w, r, "/account?updated="+updated, http.StatusSeeOther)
+			return
+		}
+
+		user, err := accounts.Users.GetByID(userID)
+		if err != nil {
+			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Pseudo       string
+			Email        string
+			PendingEmail string
+			Message      string
+			IsGuest      bool
+			HasPassword  bool
+			ReauthDelay  int
+		}{
+			IsGuest:      IsGuest(r),
+			HasPassword:  user.PasswordHash != "",
+			ReauthDelay:  int(OIDCReauthWindow.Minutes()),
+			Pseudo:       user.Pseudo,
+			Email:        user.Email,
+			PendingEmail: user.PendingEmail,
+			Message:      accountMessages[r.URL.Query().Get("updated")],
+		}
+
+		Templates.Render(w, r, "account.html", data)
+	}
+}
+
+// Retourne la cle du message a afficher, ou "" si la reponse a deja ete envoyee
+func handleAccountAction(accounts Accounts, m mailer.Mailer, w http.ResponseWriter, r *http.Request, userID int) (string, error) {
+	action := r.FormValue("action")
+
+	// Un invite n'a ni mot de passe ni adresse : il peut seulement changer de pseudo ou creer son compte
+	if IsGuest(r) && action != "pseudo" && action != "convert" {
+		return "", errors.New("cree d'abord ton compte")
+	}
+
+	switch action {
+	case "pseudo":
+		if err := ChangePseudo(accounts.Users, userID, r.FormValue("pseudo")); err != nil {
+			return "", err
+		}
+		return "pseudo", nil
+
+	case "email":
+		if err := checkCurrentPassword(accounts, userID, GetSessionID(r), r.FormValue("current_password")); err != nil {
+			return "", err
+		}
+
+		email := r.FormValue("email")
+		if err := RequestEmailChange(accounts.Users, userID, email); err != nil {
+			return "", err
+		}
+
+		user := User{ID: userID, Pseudo: GetUserPseudo(r)}
+		if err := SendEmailChangeEmail(accounts.EmailTokens, m, user, email, BaseURL(r)); err != nil {
+			log.Printf("Erreur envoi mail de changement d'adresse: %v", err)
+			return "", errors.New("impossible d'envoyer le mail de confirmation")
+		}
+		return "email", nil
+
+	case "password":
+		if err := checkCurrentPassword(accounts, userID, GetSessionID(r), r.FormValue("current_password")); err != nil {
+			return "", err
+		}
+
+		password := r.FormValue("password")
+		if password != r.FormValue("confirm_password") {
+			return "", errors.New("les mots de passe ne correspondent pas")
+		}
+
+		if err := ChangePassword(accounts, userID, GetSessionID(r), password); err != nil {
+			return "", err
+		}
+		return "password", nil
+
+	case "convert":
+		email := r.FormValue("email")
+		password := r.FormValue("password")
+		if password != r.FormValue("confirm_password") {
+			return "", errors.New("les mots de passe ne correspondent pas")
+		}
+
+		if err := ValidateEmail(email); err != nil {
+			return "", err
+		}
+		if err := ValidatePassword(password); err != nil {
+			return "", err
+		}
+
+		hashedPassword, err := HashPassword(password)
+		if err != nil {
+			return "", err
+		}
+
+		if err := accounts.Users.ConvertGuest(userID, email, hashedPassword); err != nil {
+			return "", err
+		}
+
+		user := User{ID: userID, Pseudo: GetUserPseudo(r), Email: email}
+		if err := SendVerificationEmail(accounts.EmailTokens, m, user, BaseURL(r)); err != nil {
+			log.Printf("Erreur envoi mail de verification: %v", err)
+		}
+		return "convert", nil
+
+	case "delete":
+		if err := checkCurrentPassword(accounts, userID, GetSessionID(r), r.FormValue("current_password")); err != nil {
+			return "", err
+		}
+
+		if err := accounts.Users.Delete(userID); err != nil {
+			return "", err
+		}
+
+		clearSessionCookie(w)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return "", nil
+	}
+
+	return "", errors.New("action inconnue")
+}
+
+func ConfirmEmailChangeHandler(accounts Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := ConfirmEmailChange(accounts, r.URL.Query().Get("token")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, "/account?updated=confirm", http.StatusSeeOther)
+	}
+}
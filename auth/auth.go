@@ -2,9 +2,11 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"log"
 	"regexp"
 	"time"
 	"unicode"
@@ -17,19 +19,13 @@ type User struct {
 	Pseudo       string
 	Email        string
 	PasswordHash string
+	IsGuest      bool
+	Role         string
 	CreatedAt    time.Time
-}
-
-func ValidatePseudo(pseudo string) error {
-	if len(pseudo) == 0 {
-		return errors.New("le pseudo ne peut pas etre vide")
-	}
-
-	if !unicode.IsUpper(rune(pseudo[0])) {
-		return errors.New("le pseudo doit commencer par une majuscule")
-	}
 
-	return nil
+	EmailVerified bool
+	PendingEmail  string
+	Banned        bool
 }
 
 func ValidateEmail(email string) error {
@@ -76,8 +72,12 @@ func ValidatePassword(password string) error {
 	return nil
 }
 
+// Cout bcrypt des nouveaux mots de passe (auth.bcrypt_cost). Les anciens hash
+// gardent leur cout, bcrypt le lit dans le hash lui-meme.
+var BcryptCost = 12
+
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
 	return string(bytes), err
 }
 
@@ -94,46 +94,213 @@ func GenerateSessionToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func CreateSession(db *sql.DB, userID int) (string, error) {
+// Seule l'empreinte SHA-256 du jeton est stockee en base : le jeton en clair
+// n'existe que dans le cookie du navigateur
+func HashSessionToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Durees des sessions, fixees au demarrage par la configuration (auth.*_ttl)
+var SessionDuration = 24 * time.Hour
+var RememberMeDuration = 30 * 24 * time.Hour
+var GuestSessionDuration = 6 * time.Hour
+
+// Intervalle minimum entre deux mises a jour de last_seen_at pour une meme session
+const sessionTouchInterval = time.Minute
+
+type Session struct {
+	ID         int
+	UserID     int
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	UserAgent  string
+	IPAddress  string
+	RememberMe bool
+	Guest      bool
+}
+
+func (s *Session) Duration() time.Duration {
+	if s.Guest {
+		return GuestSessionDuration
+	}
+	if s.RememberMe {
+		return RememberMeDuration
+	}
+	return SessionDuration
+}
+
+func CreateSession(db *sql.DB, userID int, userAgent string, ipAddress string, rememberMe bool) (string, error) {
+	return createSession(db, userID, userAgent, ipAddress, Session{RememberMe: rememberMe})
+}
+
+func CreateGuestSession(db *sql.DB, userID int, userAgent string, ipAddress string) (string, error) {
+	return createSession(db, userID, userAgent, ipAddress, Session{Guest: true})
+}
+
+func createSession(db *sql.DB, userID int, userAgent string, ipAddress string, session Session) (string, error) {
 	token, err := GenerateSessionToken()
 	if err != nil {
 		return "", err
 	}
 
-	expiresAt := time.Now().Add(24 * time.Hour)
+	now := time.Now().UTC()
+	expiresAt := now.Add(session.Duration())
 
-	_, err = db.Exec(
-		"INSERT INTO sessions (user_id, session_token, expires_at) VALUES (?, ?, ?)",
-		userID, token, expiresAt,
-	)
+	_, err = db.Exec(`
+		INSERT INTO sessions (user_id, session_token, expires_at, created_at, last_seen_at, user_agent, ip_address, remember_me)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, HashSessionToken(token), expiresAt, now, now, userAgent, ipAddress, session.RememberMe)
 
 	return token, err
 }
 
-func ValidateSession(db *sql.DB, token string) (*User, error) {
+func ValidateSession(db *sql.DB, token string) (*User, *Session, error) {
 	var user User
-	var expiresAt time.Time
+	var session Session
+	var lastSeenAt sql.NullTime
+	var userAgent, ipAddress sql.NullString
 
 	err := db.QueryRow(`
-		SELECT u.id, u.pseudo, u.email, u.password_hash, u.created_at, s.expires_at
+		SELECT u.id, u.pseudo, u.email, u.password_hash, u.is_guest, u.role, u.created_at,
+			s.id, s.expires_at, s.created_at, s.last_seen_at, s.user_agent, s.ip_address, COALESCE(s.remember_me, 0)
 		FROM users u
 		JOIN sessions s ON u.id = s.user_id
-		WHERE s.session_token = ?
-	`, token).Scan(&user.ID, &user.Pseudo, &user.Email, &user.PasswordHash, &user.CreatedAt, &expiresAt)
+		WHERE s.session_token = ? AND u.banned_at IS NULL
+	`, HashSessionToken(token)).Scan(&user.ID, &user.Pseudo, &user.Email, &user.PasswordHash, &user.IsGuest, &user.Role, &user.CreatedAt,
+		&session.ID, &session.ExpiresAt, &session.CreatedAt, &lastSeenAt, &userAgent, &ipAddress, &session.RememberMe)
 
 	if err != nil {
-		return nil, errors.New("session invalide")
+		return nil, nil, errors.New("session invalide")
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		db.Exec("DELETE FROM sessions WHERE id = ?", session.ID)
+		return nil, nil, errors.New("session expiree")
+	}
+
+	session.UserID = user.ID
+	session.Guest = user.IsGuest
+	session.LastSeenAt = session.CreatedAt
+	if lastSeenAt.Valid {
+		session.LastSeenAt = lastSeenAt.Time
 	}
+	session.UserAgent = userAgent.String
+	session.IPAddress = ipAddress.String
 
-	if time.Now().After(expiresAt) {
-		db.Exec("DELETE FROM sessions WHERE session_token = ?", token)
-		return nil, errors.New("session expiree")
+	return &user, &session, nil
+}
+
+// Expiration glissante : repousse l'expiration a chaque activite.
+// Retourne false si la session a deja ete prolongee il y a moins d'une minute.
+func (s *Session) Extend(ipAddress string) bool {
+	now := time.Now().UTC()
+	if now.Sub(s.LastSeenAt) < sessionTouchInterval {
+		return false
 	}
 
-	return &user, nil
+	s.LastSeenAt = now
+	s.ExpiresAt = now.Add(s.Duration())
+	s.IPAddress = ipAddress
+	return true
+}
+
+// Retourne true si la session a ete prolongee (le cookie doit alors etre renvoye)
+func TouchSession(db *sql.DB, session *Session, ipAddress string) (bool, error) {
+	if !session.Extend(ipAddress) {
+		return false, nil
+	}
+
+	_, err := db.Exec(`
+		UPDATE sessions
+		SET last_seen_at = ?, expires_at = ?, ip_address = ?
+		WHERE id = ?
+	`, session.LastSeenAt, session.ExpiresAt, ipAddress, session.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 func DeleteSession(db *sql.DB, token string) error {
-	_, err := db.Exec("DELETE FROM sessions WHERE session_token = ?", token)
+	_, err := db.Exec("DELETE FROM sessions WHERE session_token = ?", HashSessionToken(token))
+	return err
+}
+
+func GetUserSessions(db *sql.DB, userID int) ([]Session, error) {
+	rows, err := db.Query(`
+		SELECT id, expires_at, created_at, last_seen_at,
+			COALESCE(user_agent, ''), COALESCE(ip_address, ''), COALESCE(remember_me, 0)
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY COALESCE(last_seen_at, created_at) DESC
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session := Session{UserID: userID}
+		var lastSeenAt sql.NullTime
+		err := rows.Scan(&session.ID, &session.ExpiresAt, &session.CreatedAt, &lastSeenAt,
+			&session.UserAgent, &session.IPAddress, &session.RememberMe)
+		if err != nil {
+			return nil, err
+		}
+
+		session.LastSeenAt = session.CreatedAt
+		if lastSeenAt.Valid {
+			session.LastSeenAt = lastSeenAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func DeleteUserSession(db *sql.DB, userID int, sessionID int) error {
+	result, err := db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return errors.New("session introuvable")
+	}
+	return nil
+}
+
+func DeleteOtherSessions(db *sql.DB, userID int, keepSessionID int) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id = ? AND id != ?", userID, keepSessionID)
 	return err
 }
+
+func CleanupExpiredSessions(db *sql.DB) (int64, error) {
+	result, err := db.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func StartSessionCleanup(db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := CleanupExpiredSessions(db)
+		if err != nil {
+			log.Printf("Erreur nettoyage sessions: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("%d sessions expirees supprimees", deleted)
+		}
+
+		cleanupGuests(db)
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+)
+
+const CSRFTokenKey contextKey = "csrfToken"
+const csrfCookieName = "csrf_token"
+const csrfFieldName = "csrf_token"
+const csrfHeaderName = "X-CSRF-Token"
+
+// Le jeton CSRF est derive du cookie de session (un jeton par session).
+// Avant la connexion, il est derive d'un cookie aleatoire dedie (double submit).
+func deriveCSRFToken(secret string) string {
+	hash := sha256.Sum256([]byte("csrf:" + secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func CSRFMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var secret string
+
+		if cookie, err := r.Cookie("session_token"); err == nil && cookie.Value != "" {
+			secret = cookie.Value
+		} else if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+			secret = cookie.Value
+		} else {
+			generated, err := GenerateSessionToken()
+			if err != nil {
+				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+				return
+			}
+			secret = generated
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    secret,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   SecureCookies,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		expected := deriveCSRFToken(secret)
+
+		if isStateChanging(r.Method) {
+			submitted := r.Header.Get(csrfHeaderName)
+			if submitted == "" {
+				submitted = r.FormValue(csrfFieldName)
+			}
+
+			if subtle.ConstantTimeCompare([]byte(submitted), []byte(expected)) != 1 {
+				http.Error(w, "Jeton CSRF invalide, recharge la page", http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), CSRFTokenKey, expected)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func isStateChanging(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func GetCSRFToken(r *http.Request) string {
+	token, ok := r.Context().Value(CSRFTokenKey).(string)
+	if !ok {
+		return ""
+	}
+	return token
+}
+
+// Fonctions utilisables dans les templates : {{csrfField}} dans chaque formulaire POST.
+// Avec r nil elles servent seulement a declarer les noms au parsing des templates.
+func CSRFFuncs(r *http.Request) template.FuncMap {
+	var token string
+	if r != nil {
+		token = GetCSRFToken(r)
+	}
+
+	return template.FuncMap{
+		"csrfToken": func() string {
+			return token
+		},
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+	}
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	sessionA := "session-a"
+	sessionB := "session-b"
+	preLogin := "pre-login-secret"
+
+	tests := []struct {
+		name        string
+		method      string
+		cookies     []*http.Cookie
+		formToken   string
+		headerToken string
+		wantStatus  int
+	}{
+		{
+			name:       "GET sans jeton",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "POST sans jeton",
+			method:     http.MethodPost,
+			cookies:    []*http.Cookie{{Name: "session_token", Value: sessionA}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "POST avec un mauvais jeton",
+			method:     http.MethodPost,
+			cookies:    []*http.Cookie{{Name: "session_token", Value: sessionA}},
+			formToken:  "pas-le-bon",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "POST avec le jeton d'une autre session",
+			method:     http.MethodPost,
+			cookies:    []*http.Cookie{{Name: "session_token", Value: sessionA}},
+			formToken:  deriveCSRFToken(sessionB),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "POST avec le jeton de la session dans le formulaire",
+			method:     http.MethodPost,
+			cookies:    []*http.Cookie{{Name: "session_token", Value: sessionA}},
+			formToken:  deriveCSRFToken(sessionA),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "POST avec le jeton de la session en en-tete",
+			method:      http.MethodPost,
+			cookies:     []*http.Cookie{{Name: "session_token", Value: sessionA}},
+			headerToken: deriveCSRFToken(sessionA),
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:       "avant connexion : double submit valide",
+			method:     http.MethodPost,
+			cookies:    []*http.Cookie{{Name: csrfCookieName, Value: preLogin}},
+			formToken:  deriveCSRFToken(preLogin),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "avant connexion : jeton d'un autre cookie",
+			method:     http.MethodPost,
+			cookies:    []*http.Cookie{{Name: csrfCookieName, Value: preLogin}},
+			formToken:  deriveCSRFToken("autre-visiteur"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "avant connexion : jeton sans cookie",
+			method:     http.MethodPost,
+			formToken:  deriveCSRFToken(preLogin),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "jeton d'avant connexion une fois connecte",
+			method: http.MethodPost,
+			cookies: []*http.Cookie{
+				{Name: "session_token", Value: sessionA},
+				{Name: csrfCookieName, Value: preLogin},
+			},
+			formToken:  deriveCSRFToken(preLogin),
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := CSRFMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				if GetCSRFToken(r) == "" {
+					t.Error("jeton CSRF absent du contexte")
+				}
+			})
+
+			form := url.Values{}
+			if tt.formToken != "" {
+				form.Set(csrfFieldName, tt.formToken)
+			}
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.headerToken != "" {
+				req.Header.Set(csrfHeaderName, tt.headerToken)
+			}
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("statut = %d, attendu %d", rec.Code, tt.wantStatus)
+			}
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("handler appele = %v", called)
+			}
+		})
+	}
+}
+
+// Un visiteur sans cookie recoit un secret et le jeton derive de ce secret
+// est accepte a la requete suivante
+func TestCSRFMiddlewareIssuesPreLoginCookie(t *testing.T) {
+	var token string
+	handler := CSRFMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		token = GetCSRFToken(r)
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	var issued *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == csrfCookieName {
+			issued = cookie
+		}
+	}
+	if issued == nil {
+		t.Fatal("cookie CSRF non pose")
+	}
+	if !issued.HttpOnly {
+		t.Error("cookie CSRF lisible en JavaScript")
+	}
+	if token != deriveCSRFToken(issued.Value) {
+		t.Fatal("jeton de la page different de celui derive du cookie")
+	}
+
+	form := url.Values{csrfFieldName: {token}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(issued)
+
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("statut = %d, attendu %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"groupie-tracker/mailer"
+)
+
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+	TokenChangeEmail   = "change_email"
+)
+
+const verifyEmailDuration = 48 * time.Hour
+const resetPasswordDuration = time.Hour
+
+// Delai minimum entre deux mails du meme type pour un utilisateur
+const emailResendInterval = time.Minute
+
+var ErrInvalidEmailToken = errors.New("lien invalide ou expire")
+
+// Cree un jeton a usage unique. Comme pour les sessions, seule son empreinte est stockee.
+// Les jetons precedents du meme type sont invalides.
+func CreateEmailToken(db *sql.DB, userID int, purpose string, duration time.Duration) (string, error) {
+	token, err := GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+
+	_, err = db.Exec(`
+		UPDATE email_tokens SET used_at = ?
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+	`, now, userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO email_tokens (user_id, token_hash, purpose, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, HashSessionToken(token), purpose, now.Add(duration), now)
+
+	return token, err
+}
+
+// Marque le jeton comme utilise et retourne l'utilisateur associe
+func ConsumeEmailToken(db *sql.DB, token string, purpose string) (int, error) {
+	var tokenID, userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+
+	err := db.QueryRow(`
+		SELECT id, user_id, expires_at, used_at
+		FROM email_tokens
+		WHERE token_hash = ? AND purpose = ?
+	`, HashSessionToken(token), purpose).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+	if err != nil {
+		return 0, ErrInvalidEmailToken
+	}
+
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		return 0, ErrInvalidEmailToken
+	}
+
+	// La condition sur used_at evite qu'un jeton soit consomme deux fois en parallele
+	result, err := db.Exec(`
+		UPDATE email_tokens SET used_at = ?
+		WHERE id = ? AND used_at IS NULL
+	`, time.Now().UTC(), tokenID)
+	if err != nil {
+		return 0, err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return 0, ErrInvalidEmailToken
+	}
+
+	return userID, nil
+}
+
+// Verifie qu'un jeton est encore utilisable sans le consommer (affichage du formulaire)
+func CheckEmailToken(db *sql.DB, token string, purpose string) bool {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM email_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+	`, HashSessionToken(token), purpose, time.Now().UTC()).Scan(&count)
+
+	return err == nil && count > 0
+}
+
+func EmailTokenCreatedSince(db *sql.DB, userID int, purpose string, since time.Time) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM email_tokens
+		WHERE user_id = ? AND purpose = ? AND created_at > ?
+	`, userID, purpose, since).Scan(&count)
+
+	return count > 0, err
+}
+
+func emailSentRecently(tokens EmailTokenStore, userID int, purpose string) (bool, error) {
+	return tokens.CreatedSince(userID, purpose, time.Now().UTC().Add(-emailResendInterval))
+}
+
+func IsEmailVerified(db *sql.DB, userID int) (bool, error) {
+	var verified bool
+	err := db.QueryRow("SELECT email_verified FROM users WHERE id = ?", userID).Scan(&verified)
+	return verified, err
+}
+
+func MarkEmailVerified(db *sql.DB, userID int) error {
+	_, err := db.Exec("UPDATE users SET email_verified = 1 WHERE id = ?", userID)
+	return err
+}
+
+func SendVerificationEmail(tokens EmailTokenStore, m mailer.Mailer, user User, baseURL string) error {
+	recent, err := emailSentRecently(tokens, user.ID, TokenVerifyEmail)
+	if err != nil || recent {
+		return err
+	}
+
+	token, err := tokens.Create(user.ID, TokenVerifyEmail, verifyEmailDuration)
+	if err != nil {
+		return err
+	}
+
+	return m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirme ton adresse mail - Groupie Tracker",
+		Body: fmt.Sprintf("Salut %s,\n\nPour activer ton compte Groupie Tracker, ouvre ce lien :\n%s/verify-email?token=%s\n\nLe lien expire dans 48 heures.\n",
+			user.Pseudo, baseURL, token),
+	})
+}
+
+func SendPasswordResetEmail(tokens EmailTokenStore, m mailer.Mailer, user User, baseURL string) error {
+	recent, err := emailSentRecently(tokens, user.ID, TokenResetPassword)
+	if err != nil || recent {
+		return err
+	}
+
+	token, err := tokens.Create(user.ID, TokenResetPassword, resetPasswordDuration)
+	if err != nil {
+		return err
+	}
+
+	return m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reinitialisation du mot de passe - Groupie Tracker",
+		Body: fmt.Sprintf("Salut %s,\n\nPour choisir un nouveau mot de passe, ouvre ce lien :\n%s/reset-password?token=%s\n\nLe lien expire dans 1 heure et ne peut servir qu'une fois.\nSi tu n'es pas a l'origine de cette demande, ignore ce mail.\n",
+			user.Pseudo, baseURL, token),
+	})
+}
+
+// Le lien est envoye a la nouvelle adresse, qui ne remplace l'ancienne qu'une fois confirmee
+func SendEmailChangeEmail(tokens EmailTokenStore, m mailer.Mailer, user User, newEmail string, baseURL string) error {
+	token, err := tokens.Create(user.ID, TokenChangeEmail, verifyEmailDuration)
+	if err != nil {
+		return err
+	}
+
+	return m.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirme ta nouvelle adresse mail - Groupie Tracker",
+		Body: fmt.Sprintf("Salut %s,\n\nPour utiliser cette adresse sur Groupie Tracker, ouvre ce lien :\n%s/account/email/confirm?token=%s\n\nLe lien expire dans 48 heures.\nSi tu n'es pas a l'origine de cette demande, ignore ce mail.\n",
+			user.Pseudo, baseURL, token),
+	})
+}
+
+// Change le mot de passe et deconnecte toutes les sessions de l'utilisateur
+func ResetPassword(db *sql.DB, userID int, passwordHash string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	// Reinitialiser le mot de passe prouve aussi la possession de l'adresse mail
+	if _, err := tx.Exec("UPDATE users SET email_verified = 1 WHERE id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// URL publique du site utilisee dans les liens envoyes par mail.
+// A renseigner en production : sinon elle est deduite de l'en-tete Host,
+// qui est controle par le client.
+var PublicURL = ""
+
+func BaseURL(r *http.Request) string {
+	if PublicURL != "" {
+		return strings.TrimSuffix(PublicURL, "/")
+	}
+
+	scheme := "http"
+	if IsHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + RequestHost(r)
+}
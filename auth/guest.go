@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"groupie-tracker/database"
+)
+
+// Cree un compte invite : pas de mot de passe ni d'adresse mail reelle,
+// il ne sert qu'a jouer tant que la session invite est valide
+func CreateGuest(db *sql.DB, pseudo string) (*User, error) {
+	if err := ValidatePseudo(pseudo); err != nil {
+		return nil, err
+	}
+
+	if err := CheckPseudoAvailable(db, pseudo, 0); err != nil {
+		return nil, err
+	}
+
+	// L'email est unique et obligatoire : on utilise une adresse invalide aleatoire
+	suffix, err := GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	email := "invite-" + suffix[:16] + "@invalid"
+
+	result, err := db.Exec(`
+		INSERT INTO users (pseudo, pseudo_key, email, password_hash, is_guest)
+		VALUES (?, ?, ?, '', 1)
+	`, pseudo, PseudoKey(pseudo), email)
+	if database.IsUniqueViolation(err) {
+		return nil, ErrPseudoTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{ID: int(userID), Pseudo: pseudo, Email: email, IsGuest: true}, nil
+}
+
+// Transforme un invite en compte complet en gardant son id, donc ses scores et parties
+func ConvertGuest(db *sql.DB, userID int, email string, passwordHash string) error {
+	result, err := db.Exec(`
+		UPDATE users SET email = ?, password_hash = ?, is_guest = 0, email_verified = 0
+		WHERE id = ? AND is_guest = 1
+	`, email, passwordHash, userID)
+	if database.IsUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errors.New("ce compte n'est pas un compte invite")
+	}
+
+	return nil
+}
+
+// Les invites dont toutes les sessions ont expire sont anonymises pour liberer leur pseudo
+func CleanupExpiredGuests(db *sql.DB) (int, error) {
+	rows, err := db.Query(`
+		SELECT id FROM users
+		WHERE is_guest = 1 AND deleted_at IS NULL
+			AND id NOT IN (SELECT user_id FROM sessions WHERE expires_at > ?)
+	`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	var guestIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		guestIDs = append(guestIDs, id)
+	}
+	rows.Close()
+
+	for _, id := range guestIDs {
+		if err := DeleteAccount(db, id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(guestIDs), nil
+}
+
+func cleanupGuests(db *sql.DB) {
+	deleted, err := CleanupExpiredGuests(db)
+	if err != nil {
+		log.Printf("Erreur nettoyage invites: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("%d comptes invites expires anonymises", deleted)
+	}
+}
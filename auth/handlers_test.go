@@ -0,0 +1,308 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"groupie-tracker/auth"
+	"groupie-tracker/mailer"
+	"groupie-tracker/store"
+)
+
+const testPassword = "Motdepasse-123"
+
+type captureMailer struct {
+	sent []mailer.Message
+}
+
+func (m *captureMailer) Send(msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+// Jeton du dernier lien envoye par mail
+func (m *captureMailer) lastToken(t *testing.T) string {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatal("aucun mail envoye")
+	}
+	match := tokenPattern.FindStringSubmatch(m.sent[len(m.sent)-1].Body)
+	if match == nil {
+		t.Fatal("lien sans jeton dans le mail")
+	}
+	return match[1]
+}
+
+func init() {
+	auth.BcryptCost = 4
+}
+
+func postForm(t *testing.T, handler http.HandlerFunc, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "192.0.2.1:1234"
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			return cookie
+		}
+	}
+	t.Fatal("pas de cookie de session")
+	return nil
+}
+
+func register(t *testing.T, accounts auth.Accounts, m mailer.Mailer, pseudo string, email string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postForm(t, auth.RegisterHandler(accounts, m), "/register", url.Values{
+		"pseudo":           {pseudo},
+		"email":            {email},
+		"password":         {testPassword},
+		"confirm_password": {testPassword},
+	})
+}
+
+func login(t *testing.T, accounts auth.Accounts, identifier string, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postForm(t, auth.LoginHandler(accounts, &captureMailer{}, nil), "/login", url.Values{
+		"identifier": {identifier},
+		"password":   {password},
+	})
+}
+
+func TestRegisterVerifyAndLogin(t *testing.T) {
+	stores := store.NewMemory()
+	accounts := stores.Accounts()
+	m := &captureMailer{}
+
+	if rec := register(t, accounts, m, "Alice", "alice@example.com"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("inscription: statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+	}
+
+	// Le compte n'est pas encore active
+	if rec := login(t, accounts, "alice@example.com", testPassword); rec.Code != http.StatusForbidden {
+		t.Fatalf("connexion avant activation: statut %d, attendu %d", rec.Code, http.StatusForbidden)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/verify-email?token="+m.lastToken(t), nil)
+	rec := httptest.NewRecorder()
+	auth.VerifyEmailHandler(accounts)(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("activation: statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+	}
+
+	rec = login(t, accounts, "Alice", testPassword)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("connexion: statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+	}
+
+	user, _, err := stores.Sessions.Validate(sessionCookie(t, rec).Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Pseudo != "Alice" {
+		t.Errorf("session de %q, attendu Alice", user.Pseudo)
+	}
+}
+
+func TestRegisterRejectsLookalikePseudo(t *testing.T) {
+	accounts := store.NewMemory().Accounts()
+	m := &captureMailer{}
+
+	if rec := register(t, accounts, m, "Alice", "alice@example.com"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("inscription: statut %d", rec.Code)
+	}
+
+	tests := []struct {
+		name   string
+		pseudo string
+		email  string
+	}{
+		{"meme pseudo", "Alice", "autre@example.com"},
+		{"casse differente", "ALICE", "autre@example.com"},
+		{"caractere confusable", "A1ice", "autre@example.com"},
+		{"meme adresse", "Bob", "alice@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := register(t, accounts, m, tt.pseudo, tt.email); rec.Code != http.StatusConflict {
+				t.Errorf("statut %d, attendu %d", rec.Code, http.StatusConflict)
+			}
+		})
+	}
+}
+
+func TestLoginThrottlesRepeatedFailures(t *testing.T) {
+	stores := store.NewMemory()
+	accounts := stores.Accounts()
+
+	user, err := stores.Users.Create("Alice", "alice@example.com", mustHash(t, testPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores.Users.MarkEmailVerified(user.ID)
+
+	if rec := login(t, accounts, "Alice", "mauvais-mot-de-passe"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("premier echec: statut %d, attendu %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Apres un echec le compte attend une seconde, meme avec le bon mot de passe
+	rec := login(t, accounts, "alice", testPassword)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("statut %d, attendu %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("en-tete Retry-After absent")
+	}
+}
+
+func TestLoginRejectsBannedAccount(t *testing.T) {
+	stores := store.NewMemory()
+	accounts := stores.Accounts()
+
+	user, err := stores.Users.Create("Alice", "alice@example.com", mustHash(t, testPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores.Users.MarkEmailVerified(user.ID)
+	if err := stores.Admin.Ban(user.ID, "triche"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := login(t, accounts, "Alice", testPassword); rec.Code != http.StatusForbidden {
+		t.Errorf("statut %d, attendu %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAccountAndSessionsHandlers(t *testing.T) {
+	stores := store.NewMemory()
+	accounts := stores.Accounts()
+	m := &captureMailer{}
+
+	alice, err := stores.Users.Create("Alice", "alice@example.com", mustHash(t, testPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stores.Users.Create("Bob", "bob@example.com", mustHash(t, testPassword)); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := stores.Sessions.Create(alice.ID, "navigateur", "192.0.2.1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stores.Sessions.Create(alice.ID, "telephone", "192.0.2.2", false); err != nil {
+		t.Fatal(err)
+	}
+	cookie := &http.Cookie{Name: "session_token", Value: current}
+
+	account := auth.AuthMiddleware(stores.Sessions, auth.AccountHandler(accounts, m))
+	sessions := auth.AuthMiddleware(stores.Sessions, auth.SessionsHandler(stores.Sessions))
+
+	t.Run("pseudo pris par un autre compte", func(t *testing.T) {
+		rec := postForm(t, account, "/account", url.Values{"action": {"pseudo"}, "pseudo": {"B0b"}}, cookie)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("statut %d, attendu %d", rec.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("changement de pseudo", func(t *testing.T) {
+		rec := postForm(t, account, "/account", url.Values{"action": {"pseudo"}, "pseudo": {"Alicia"}}, cookie)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+		}
+		if _, err := stores.Users.GetByPseudo("Alicia"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("mauvais mot de passe actuel", func(t *testing.T) {
+		rec := postForm(t, account, "/account", url.Values{
+			"action":           {"email"},
+			"email":            {"nouvelle@example.com"},
+			"current_password": {"mauvais-mot-de-passe"},
+		}, cookie)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("statut %d, attendu %d", rec.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("changement d'adresse confirme par mail", func(t *testing.T) {
+		rec := postForm(t, account, "/account", url.Values{
+			"action":           {"email"},
+			"email":            {"nouvelle@example.com"},
+			"current_password": {testPassword},
+		}, cookie)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/account/email/confirm?token="+m.lastToken(t), nil)
+		rec = httptest.NewRecorder()
+		auth.ConfirmEmailChangeHandler(accounts)(rec, req)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("confirmation: statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+		}
+
+		user, err := stores.Users.GetByID(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "nouvelle@example.com" || user.PendingEmail != "" {
+			t.Errorf("adresse %q, en attente %q", user.Email, user.PendingEmail)
+		}
+	})
+
+	t.Run("deconnexion des autres appareils", func(t *testing.T) {
+		rec := postForm(t, sessions, "/account/sessions", url.Values{"action": {"revoke_others"}}, cookie)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+		}
+
+		list, err := stores.Sessions.ListForUser(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 {
+			t.Errorf("%d sessions restantes, attendu 1", len(list))
+		}
+	})
+
+	t.Run("suppression du compte", func(t *testing.T) {
+		rec := postForm(t, account, "/account", url.Values{"action": {"delete"}, "current_password": {testPassword}}, cookie)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+		}
+		if _, _, err := stores.Sessions.Validate(current); err == nil {
+			t.Error("session encore valide apres suppression du compte")
+		}
+		if err := stores.Users.CheckPseudoAvailable("Alicia", 0); err != nil {
+			t.Errorf("pseudo du compte supprime non libere: %v", err)
+		}
+	})
+}
+
+func mustHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
@@ -1,50 +1,123 @@
 package auth
 
 import (
-	"database/sql"
-	"html/template"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
+
+	"groupie-tracker/mailer"
+	"groupie-tracker/render"
 )
 
-func LoginHandler(db *sql.DB) http.HandlerFunc {
+// Messages affiches sur la page de connexion apres une redirection
+var loginMessages = map[string]string{
+	"registered": "Compte cree ! Clique sur le lien recu par mail pour l'activer.",
+	"verified":   "Adresse mail confirmee, tu peux te connecter.",
+	"reset":      "Mot de passe modifie, tu peux te connecter.",
+}
+
+// oidc vaut nil si aucun fournisseur d'identite n'est configure
+func LoginHandler(accounts Accounts, m mailer.Mailer, oidc *OIDCProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
-			tmpl := template.Must(template.ParseFiles("templates/login.html"))
-			tmpl.Execute(w, nil)
+			var message string
+			for key, text := range loginMessages {
+				if r.URL.Query().Get(key) != "" {
+					message = text
+				}
+			}
+
+			data := map[string]string{"Message": message}
+			if oidc != nil {
+				data["OIDCName"] = oidc.Name
+			}
+
+			Templates.Render(w, r, "login.html", data)
 			return
 		}
 
 		if r.Method == "POST" {
 			identifier := r.FormValue("identifier")
 			password := r.FormValue("password")
+			ipAddress := ClientIP(r)
+
+			user, err := accounts.Users.GetByLogin(identifier)
+			if err != nil {
+				user = &User{}
+			}
+
+			wait, err := LoginRetryAfter(accounts.LoginAttempts, identifier, user.ID, ipAddress)
+			if err != nil {
+				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+				return
+			}
+			if wait > 0 {
+				seconds := int(wait.Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				http.Error(w, fmt.Sprintf("Trop de tentatives, reessaie dans %d secondes", seconds), http.StatusTooManyRequests)
+				return
+			}
 
-			var user User
-			err := db.QueryRow(`
-				SELECT id, pseudo, email, password_hash 
-				FROM users 
-				WHERE pseudo = ? OR email = ?
-			`, identifier, identifier).Scan(&user.ID, &user.Pseudo, &user.Email, &user.PasswordHash)
+			success := CheckPasswordOrDummy(password, user.PasswordHash)
+			if err := accounts.LoginAttempts.Record(normalizeIdentifier(identifier), user.ID, ipAddress, success); err != nil {
+				log.Printf("Erreur enregistrement tentative de connexion: %v", err)
+			}
 
-			if err != nil || !CheckPassword(password, user.PasswordHash) {
+			if !success {
 				http.Error(w, "Identifiants incorrects", http.StatusUnauthorized)
 				return
 			}
 
-			token, err := CreateSession(db, user.ID)
+			if user.Banned {
+				http.Error(w, "Compte suspendu", http.StatusForbidden)
+				return
+			}
+
+			// Le mot de passe est correct : on peut reveler que l'adresse n'est pas confirmee
+			if !user.EmailVerified {
+				if err := SendVerificationEmail(accounts.EmailTokens, m, *user, BaseURL(r)); err != nil {
+					log.Printf("Erreur envoi mail de verification: %v", err)
+				}
+				http.Error(w, "Adresse mail non confirmee, un lien d'activation t'a ete envoye par mail", http.StatusForbidden)
+				return
+			}
+
+			rememberMe := r.FormValue("remember_me") == "on"
+
+			token, err := accounts.Sessions.Create(user.ID, r.UserAgent(), ipAddress, rememberMe)
 			if err != nil {
 				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
 				return
 			}
 
-			http.SetCookie(w, &http.Cookie{
-				Name:     "session_token",
-				Value:    token,
-				Path:     "/",
-				HttpOnly: true,
-				MaxAge:   86400,
-			})
+			duration := SessionDuration
+			if rememberMe {
+				duration = RememberMeDuration
+			}
+			SetSessionCookie(w, token, duration)
 
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 		}
 	}
+}
+
+// Cookies reserves a HTTPS, fixe au demarrage : vrai quand le serveur ecoute en
+// TLS (server.tls_cert) ou que server.public_url est en https:// (reverse proxy)
+var SecureCookies = true
+
+// Pages HTML, fixees au demarrage par main (templates embarques ou server.templates_dir)
+var Templates *render.Renderer
+
+func SetSessionCookie(w http.ResponseWriter, token string, duration time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(duration.Seconds()),
+	})
 }
\ No newline at end of file
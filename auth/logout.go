@@ -1,24 +1,33 @@
 package auth
 
-import (
-	"database/sql"
-	"net/http"
-)
+import "net/http"
 
-func LogoutHandler(db *sql.DB) http.HandlerFunc {
+func LogoutHandler(sessions SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Methode non autorisee", http.StatusMethodNotAllowed)
+			return
+		}
+
 		cookie, err := r.Cookie("session_token")
 		if err == nil {
-			DeleteSession(db, cookie.Value)
+			sessions.Delete(cookie.Value)
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:   "session_token",
-			Value:  "",
-			Path:   "/",
-			MaxAge: -1,
-		})
+		clearSessionCookie(w)
 
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 	}
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
 }
\ No newline at end of file
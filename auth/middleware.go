@@ -2,7 +2,7 @@ package auth
 
 import (
 	"context"
-	"database/sql"
+	"log"
 	"net/http"
 	"strconv"
 )
@@ -11,26 +11,65 @@ type contextKey string
 
 const UserIDKey contextKey = "userID"
 const UserPseudoKey contextKey = "userPseudo"
+const SessionIDKey contextKey = "sessionID"
+const IsGuestKey contextKey = "isGuest"
+const UserRoleKey contextKey = "userRole"
 
-func AuthMiddleware(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+// Sessions utilisees par les middlewares, implemente par store.SessionStore
+type SessionValidator interface {
+	Validate(token string) (*User, *Session, error)
+	Touch(session *Session, ipAddress string) (bool, error)
+}
+
+func AuthMiddleware(sessions SessionValidator, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_token")
-		if err != nil {
+		authenticated, ok := authenticate(sessions, w, r)
+		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		user, err := ValidateSession(db, cookie.Value)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
+		next(w, authenticated)
+	}
+}
+
+// Comme AuthMiddleware mais laisse passer les visiteurs sans session (GetUserID vaut alors 0)
+func OptionalAuthMiddleware(sessions SessionValidator, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authenticated, ok := authenticate(sessions, w, r); ok {
+			r = authenticated
 		}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
-		ctx = context.WithValue(ctx, UserPseudoKey, user.Pseudo)
-		
-		next(w, r.WithContext(ctx))
+		next(w, r)
+	}
+}
+
+func authenticate(sessions SessionValidator, w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return r, false
+	}
+
+	user, session, err := sessions.Validate(cookie.Value)
+	if err != nil {
+		return r, false
 	}
+
+	extended, err := sessions.Touch(session, ClientIP(r))
+	if err != nil {
+		log.Printf("Erreur mise a jour session: %v", err)
+	}
+	if extended {
+		SetSessionCookie(w, cookie.Value, session.Duration())
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
+	ctx = context.WithValue(ctx, UserPseudoKey, user.Pseudo)
+	ctx = context.WithValue(ctx, SessionIDKey, session.ID)
+	ctx = context.WithValue(ctx, IsGuestKey, user.IsGuest)
+	ctx = context.WithValue(ctx, UserRoleKey, user.Role)
+
+	return r.WithContext(ctx), true
 }
 
 func GetUserID(r *http.Request) int {
@@ -51,4 +90,17 @@ func GetUserPseudo(r *http.Request) string {
 
 func GetUserIDStr(r *http.Request) string {
 	return strconv.Itoa(GetUserID(r))
-}
\ No newline at end of file
+}
+
+func GetSessionID(r *http.Request) int {
+	sessionID, ok := r.Context().Value(SessionIDKey).(int)
+	if !ok {
+		return 0
+	}
+	return sessionID
+}
+
+func IsGuest(r *http.Request) bool {
+	isGuest, _ := r.Context().Value(IsGuestKey).(bool)
+	return isGuest
+}
@@ -0,0 +1,462 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"groupie-tracker/database"
+)
+
+const oidcStateCookie = "oidc_state"
+const oidcStateDuration = 10 * time.Minute
+
+// Fournisseur d'identite OpenID Connect (flux authorization code + PKCE)
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Vide : deduite de la requete (BaseURL + /auth/oidc/callback)
+	RedirectURL string
+
+	client    *http.Client
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type oidcTokens struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+}
+
+type OIDCClaims struct {
+	Issuer            string      `json:"iss"`
+	Subject           string      `json:"sub"`
+	Audience          interface{} `json:"aud"`
+	ExpiresAt         int64       `json:"exp"`
+	Nonce             string      `json:"nonce"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"`
+	Name              string      `json:"name"`
+	PreferredUsername string      `json:"preferred_username"`
+}
+
+func NewOIDCProvider(name string, issuer string, clientID string, clientSecret string) *OIDCProvider {
+	return &OIDCProvider{
+		Name:         name,
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OIDCProvider) redirectURL(r *http.Request) string {
+	if p.RedirectURL != "" {
+		return p.RedirectURL
+	}
+	return BaseURL(r) + "/auth/oidc/callback"
+}
+
+// Le jeton d'identite est recu directement du fournisseur : sa signature n'est pas
+// verifiee, l'authenticite repose sur TLS (OpenID Connect Core 3.1.3.7).
+// On refuse donc tout emetteur en HTTP, sauf en local pour le fournisseur de test.
+func (p *OIDCProvider) checkIssuerURL() error {
+	issuer, err := url.Parse(p.Issuer)
+	if err != nil {
+		return err
+	}
+	if issuer.Scheme == "https" {
+		return nil
+	}
+	host := issuer.Hostname()
+	if issuer.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1") {
+		return nil
+	}
+	return errors.New("l'emetteur OIDC doit utiliser HTTPS")
+}
+
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	if err := p.checkIssuerURL(); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Get(p.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("decouverte OIDC: statut %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, errors.New("decouverte OIDC: emetteur inattendu")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+func (p *OIDCProvider) authCodeURL(r *http.Request, state string, nonce string, verifier string) (string, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.redirectURL(r)},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	return discovery.AuthorizationEndpoint + "?" + params.Encode(), nil
+}
+
+func (p *OIDCProvider) exchange(r *http.Request, code string, verifier string) (*oidcTokens, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL(r)},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequest("POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("echange du code OIDC: statut %d", resp.StatusCode)
+	}
+
+	var tokens oidcTokens
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("echange du code OIDC: jeton d'identite absent")
+	}
+
+	return &tokens, nil
+}
+
+func (p *OIDCProvider) claims(tokens *oidcTokens, nonce string) (*OIDCClaims, error) {
+	parts := strings.Split(tokens.IDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jeton d'identite invalide")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("jeton d'identite invalide")
+	}
+
+	var claims OIDCClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("jeton d'identite invalide")
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != p.Issuer {
+		return nil, errors.New("jeton d'identite: emetteur inattendu")
+	}
+	if !claims.hasAudience(p.ClientID) {
+		return nil, errors.New("jeton d'identite: audience inattendue")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("jeton d'identite expire")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("jeton d'identite: nonce invalide")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("jeton d'identite: sujet absent")
+	}
+
+	// Certains fournisseurs ne mettent l'email que dans userinfo
+	if claims.Email == "" && tokens.AccessToken != "" {
+		if err := p.fetchUserinfo(tokens.AccessToken, &claims); err != nil {
+			log.Printf("Erreur userinfo OIDC: %v", err)
+		}
+	}
+
+	return &claims, nil
+}
+
+func (p *OIDCProvider) fetchUserinfo(accessToken string, claims *OIDCClaims) error {
+	discovery, err := p.discover()
+	if err != nil || discovery.UserinfoEndpoint == "" {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("statut %d", resp.StatusCode)
+	}
+
+	var info OIDCClaims
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return err
+	}
+
+	// Le sujet de userinfo doit etre celui du jeton d'identite
+	if info.Subject != claims.Subject {
+		return errors.New("sujet userinfo different")
+	}
+
+	claims.Email = info.Email
+	claims.EmailVerified = info.EmailVerified
+	if claims.Name == "" {
+		claims.Name = info.Name
+	}
+	if claims.PreferredUsername == "" {
+		claims.PreferredUsername = info.PreferredUsername
+	}
+	return nil
+}
+
+func (c *OIDCClaims) hasAudience(clientID string) bool {
+	switch aud := c.Audience.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// email_verified est un booleen, mais certains fournisseurs l'envoient en texte
+func (c *OIDCClaims) IsEmailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func pkceChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// Retrouve ou cree l'utilisateur correspondant a l'identite OIDC
+func FindOrCreateOIDCUser(db *sql.DB, claims *OIDCClaims) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT i.user_id FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = ? AND i.subject = ? AND u.deleted_at IS NULL
+	`, claims.Issuer, claims.Subject).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// Liaison a un compte existant uniquement si le fournisseur garantit l'adresse
+	if claims.Email != "" && claims.IsEmailVerified() {
+		var localVerified bool
+		err := db.QueryRow(`
+			SELECT id, email_verified FROM users
+			WHERE email = ? AND deleted_at IS NULL AND is_guest = 0
+		`, claims.Email).Scan(&userID, &localVerified)
+		if err == nil {
+			return userID, linkExistingUser(db, userID, localVerified, claims)
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	userID, err = createOIDCUser(db, claims)
+	if err != nil {
+		return 0, err
+	}
+	return userID, linkIdentity(db, userID, claims)
+}
+
+// Un compte local dont l'adresse n'a jamais ete confirmee a pu etre cree par
+// quelqu'un d'autre que le proprietaire de l'adresse : son mot de passe est
+// efface et ses sessions fermees, seul le titulaire OIDC garde l'acces.
+func linkExistingUser(db *sql.DB, userID int, localVerified bool, claims *OIDCClaims) error {
+	if localVerified {
+		return linkIdentity(db, userID, claims)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = '', email_verified = 1, pending_email = NULL WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email)
+		VALUES (?, ?, ?, ?)
+	`, userID, claims.Issuer, claims.Subject, claims.Email); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func linkIdentity(db *sql.DB, userID int, claims *OIDCClaims) error {
+	_, err := db.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email)
+		VALUES (?, ?, ?, ?)
+	`, userID, claims.Issuer, claims.Subject, claims.Email)
+	return err
+}
+
+// Nouveau compte sans mot de passe (il pourra en definir un via "mot de passe oublie")
+func createOIDCUser(db *sql.DB, claims *OIDCClaims) (int, error) {
+	email := claims.Email
+	verified := claims.IsEmailVerified()
+
+	var taken int
+	if email != "" {
+		if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&taken); err != nil {
+			return 0, err
+		}
+	}
+	// Adresse absente, non verifiee ou deja prise par un autre compte : adresse de substitution
+	if email == "" || !verified || taken > 0 {
+		hash := sha256.Sum256([]byte(claims.Issuer + "|" + claims.Subject))
+		email = fmt.Sprintf("oidc-%x@invalid", hash[:8])
+		verified = false
+	}
+
+	base := oidcPseudo(claims)
+	for i := 0; i < 100; i++ {
+		pseudo := base
+		if i > 0 {
+			pseudo = fmt.Sprintf("%s%d", base, i+1)
+		}
+
+		if CheckPseudoAvailable(db, pseudo, 0) != nil {
+			continue
+		}
+
+		result, err := db.Exec(`
+			INSERT INTO users (pseudo, pseudo_key, email, password_hash, email_verified)
+			VALUES (?, ?, ?, '', ?)
+		`, pseudo, PseudoKey(pseudo), email, verified)
+		// Pseudo pris entre la verification et l'insertion : on essaie le suivant
+		if database.IsUniqueViolation(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		userID, err := result.LastInsertId()
+		return int(userID), err
+	}
+
+	return 0, errors.New("impossible de choisir un pseudo")
+}
+
+var pseudoCleaner = regexp.MustCompile(`[^\pL\pN_.-]+`)
+
+// Derive un pseudo valide (commencant par une majuscule) a partir des claims
+func oidcPseudo(claims *OIDCClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate = claims.Name
+	}
+	if candidate == "" && claims.Email != "" {
+		candidate = strings.Split(claims.Email, "@")[0]
+	}
+
+	candidate = pseudoCleaner.ReplaceAllString(candidate, "")
+	runes := []rune(candidate)
+	// Place pour le suffixe numerique en cas de doublon
+	if len(runes) > PseudoMaxLength-2 {
+		runes = runes[:PseudoMaxLength-2]
+	}
+	if len(runes) == 0 || !unicode.IsLetter(runes[0]) {
+		return "Joueur"
+	}
+
+	runes[0] = unicode.ToUpper(runes[0])
+	pseudo := string(runes)
+	if ValidatePseudo(pseudo) != nil {
+		return "Joueur"
+	}
+	return pseudo
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func OIDCLoginHandler(p *OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// state protege le retour contre le CSRF, nonce lie le jeton d'identite
+		// a cette tentative et verifier sert au PKCE
+		var values [3]string
+		for i := range values {
+			value, err := GenerateSessionToken()
+			if err != nil {
+				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+				return
+			}
+			values[i] = value
+		}
+		state, nonce, verifier := values[0], values[1], values[2]
+
+		authURL, err := p.authCodeURL(r, state, nonce, verifier)
+		if err != nil {
+			log.Printf("Erreur OIDC: %v", err)
+			http.Error(w, "Fournisseur d'identite indisponible", http.StatusBadGateway)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    strings.Join(values[:], "."),
+			Path:     "/auth/oidc/",
+			HttpOnly: true,
+			Secure:   SecureCookies,
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   int(oidcStateDuration.Seconds()),
+		})
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+func OIDCCallbackHandler(db *sql.DB, p *OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil {
+			http.Error(w, "Connexion expiree, recommence", http.StatusBadRequest)
+			return
+		}
+
+		// Le cookie ne sert qu'une fois
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    "",
+			Path:     "/auth/oidc/",
+			HttpOnly: true,
+			Secure:   SecureCookies,
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   -1,
+		})
+
+		values := strings.Split(cookie.Value, ".")
+		if len(values) != 3 {
+			http.Error(w, "Connexion expiree, recommence", http.StatusBadRequest)
+			return
+		}
+		state, nonce, verifier := values[0], values[1], values[2]
+
+		query := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+			http.Error(w, "Etat de connexion invalide", http.StatusBadRequest)
+			return
+		}
+
+		if errCode := query.Get("error"); errCode != "" {
+			http.Error(w, "Connexion refusee par le fournisseur : "+errCode, http.StatusUnauthorized)
+			return
+		}
+
+		tokens, err := p.exchange(r, query.Get("code"), verifier)
+		if err != nil {
+			log.Printf("Erreur OIDC: %v", err)
+			http.Error(w, "Connexion impossible avec le fournisseur", http.StatusBadGateway)
+			return
+		}
+
+		claims, err := p.claims(tokens, nonce)
+		if err != nil {
+			log.Printf("Erreur OIDC: %v", err)
+			http.Error(w, "Connexion impossible avec le fournisseur", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := FindOrCreateOIDCUser(db, claims)
+		if err != nil {
+			log.Printf("Erreur compte OIDC: %v", err)
+			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+			return
+		}
+
+		if banned, err := IsBanned(db, userID); err != nil || banned {
+			http.Error(w, "Compte suspendu", http.StatusForbidden)
+			return
+		}
+
+		ipAddress := ClientIP(r)
+		if err := RecordLoginAttempt(db, claims.Email, userID, ipAddress, true); err != nil {
+			log.Printf("Erreur enregistrement tentative de connexion: %v", err)
+		}
+
+		token, err := CreateSession(db, userID, r.UserAgent(), ipAddress, false)
+		if err != nil {
+			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+			return
+		}
+		SetSessionCookie(w, token, SessionDuration)
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,270 @@
+// Fournisseur OpenID Connect minimal pour le developpement et les tests :
+// il accepte n'importe quelle adresse saisie et ne depend d'aucun service externe.
+package oidcmock
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const codeDuration = time.Minute
+const tokenDuration = time.Hour
+
+type Server struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	codes  map[string]*grant
+	tokens map[string]*grant
+}
+
+// Un code d'autorisation, puis le jeton d'acces obtenu en l'echangeant
+type grant struct {
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	ExpiresAt     time.Time
+}
+
+func NewServer(issuer string, clientID string, clientSecret string) *Server {
+	return &Server{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		codes:        make(map[string]*grant),
+		tokens:       make(map[string]*grant),
+	}
+}
+
+// A monter sous le chemin de l'emetteur avec http.StripPrefix
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		s.discovery(w, r)
+	case "/authorize":
+		s.authorize(w, r)
+	case "/token":
+		s.token(w, r)
+	case "/userinfo":
+		s.userinfo(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"userinfo_endpoint":                     s.Issuer + "/userinfo",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"HS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="fr">
+<head><meta charset="UTF-8"><title>Fournisseur de test</title></head>
+<body style="font-family: Arial, sans-serif; max-width: 400px; margin: 50px auto;">
+    <h1>Fournisseur de test</h1>
+    <p>Choisis l'identite avec laquelle te connecter.</p>
+    <form method="POST">
+        {{range $key, $values := .Params}}{{range $values}}<input type="hidden" name="{{$key}}" value="{{.}}">{{end}}{{end}}
+        <p><label>Adresse mail<br><input type="email" name="email" value="test@example.com" required></label></p>
+        <p><label>Nom<br><input type="text" name="name" value="Testeur"></label></p>
+        <p><label><input type="checkbox" name="email_verified" checked> Adresse verifiee</label></p>
+        <button type="submit">Se connecter</button>
+    </form>
+</body>
+</html>`))
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "requete invalide", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("client_id") != s.ClientID || r.Form.Get("response_type") != "code" {
+		http.Error(w, "client ou response_type invalide", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+		http.Error(w, "PKCE S256 obligatoire", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "redirect_uri invalide", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "GET" {
+		params := url.Values{}
+		for _, key := range []string{"client_id", "response_type", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params[key] = r.Form[key]
+		}
+		authorizeTemplate.Execute(w, map[string]interface{}{"Params": params})
+		return
+	}
+
+	email := r.PostForm.Get("email")
+	code := randomToken()
+
+	s.mu.Lock()
+	s.codes[code] = &grant{
+		RedirectURI:   redirectURI.String(),
+		CodeChallenge: r.Form.Get("code_challenge"),
+		Nonce:         r.Form.Get("nonce"),
+		Subject:       subjectFor(email),
+		Email:         email,
+		EmailVerified: r.PostForm.Get("email_verified") != "",
+		Name:          r.PostForm.Get("name"),
+		ExpiresAt:     time.Now().Add(codeDuration),
+	}
+	s.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "methode non autorisee", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != s.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// Un code ne peut etre echange qu'une fois
+	s.mu.Lock()
+	g, found := s.codes[r.PostFormValue("code")]
+	delete(s.codes, r.PostFormValue("code"))
+	s.mu.Unlock()
+
+	if !found || time.Now().After(g.ExpiresAt) || g.RedirectURI != r.PostFormValue("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	verifierHash := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifierHash[:]) != g.CodeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier invalide"})
+		return
+	}
+
+	accessToken := randomToken()
+	g.ExpiresAt = time.Now().Add(tokenDuration)
+
+	s.mu.Lock()
+	s.tokens[accessToken] = g
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenDuration.Seconds()),
+		"id_token":     s.idToken(g),
+	})
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	g, found := s.tokens[accessToken]
+	s.mu.Unlock()
+
+	if !found || time.Now().After(g.ExpiresAt) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            g.Subject,
+		"email":          g.Email,
+		"email_verified": g.EmailVerified,
+		"name":           g.Name,
+	})
+}
+
+// Jeton signe en HS256 avec le secret du client
+func (s *Server) idToken(g *grant) string {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":            s.Issuer,
+		"sub":            g.Subject,
+		"aud":            s.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(tokenDuration).Unix(),
+		"nonce":          g.Nonce,
+		"email":          g.Email,
+		"email_verified": g.EmailVerified,
+		"name":           g.Name,
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(s.ClientSecret))
+	mac.Write([]byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Le sujet est stable pour une meme adresse, comme chez un vrai fournisseur
+func subjectFor(email string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(hash[:16])
+}
+
+func randomToken() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+
+	"groupie-tracker/mailer"
+)
+
+type passwordPageData struct {
+	Token   string
+	Message string
+	Error   string
+}
+
+func ForgotPasswordHandler(accounts Accounts, m mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			Templates.Render(w, r, "forgot_password.html", passwordPageData{})
+			return
+		}
+
+		if r.Method == "POST" {
+			email := r.FormValue("email")
+
+			user, err := accounts.Users.GetByEmail(email)
+			if err == nil {
+				if err := SendPasswordResetEmail(accounts.EmailTokens, m, *user, BaseURL(r)); err != nil {
+					log.Printf("Erreur envoi mail de reinitialisation: %v", err)
+				}
+			}
+
+			// Meme reponse que le compte existe ou non
+			Templates.Render(w, r, "forgot_password.html", passwordPageData{
+				Message: "Si un compte correspond a cette adresse, un lien de reinitialisation vient d'etre envoye.",
+			})
+		}
+	}
+}
+
+func ResetPasswordHandler(accounts Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.FormValue("token")
+
+		// Le jeton est dans l'URL : il ne doit pas fuiter vers d'autres sites
+		w.Header().Set("Referrer-Policy", "no-referrer")
+
+		if r.Method == "GET" {
+			data := passwordPageData{Token: token}
+			if !accounts.EmailTokens.Check(token, TokenResetPassword) {
+				data.Error = ErrInvalidEmailToken.Error()
+			}
+			Templates.Render(w, r, "reset_password.html", data)
+			return
+		}
+
+		if r.Method == "POST" {
+			password := r.FormValue("password")
+			confirmPassword := r.FormValue("confirm_password")
+
+			if password != confirmPassword {
+				http.Error(w, "Les mots de passe ne correspondent pas", http.StatusBadRequest)
+				return
+			}
+
+			if err := ValidatePassword(password); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			userID, err := accounts.EmailTokens.Consume(token, TokenResetPassword)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			hashedPassword, err := HashPassword(password)
+			if err != nil {
+				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+				return
+			}
+
+			if err := accounts.Users.ResetPassword(userID, hashedPassword); err != nil {
+				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+				return
+			}
+
+			http.Redirect(w, r, "/login?reset=1", http.StatusSeeOther)
+		}
+	}
+}
+
+func VerifyEmailHandler(accounts Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := accounts.EmailTokens.Consume(r.URL.Query().Get("token"), TokenVerifyEmail)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := accounts.Users.MarkEmailVerified(userID); err != nil {
+			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/login?verified=1", http.StatusSeeOther)
+	}
+}
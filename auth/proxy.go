@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Reverse proxies dont on croit les en-tetes X-Forwarded-*, fixes au demarrage
+// par la configuration (server.trusted_proxies). Vide : ces en-tetes sont ignores,
+// n'importe quel client pouvant les envoyer.
+var TrustedProxies []*net.IPNet
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Adresse du visiteur. Derriere un proxy de confiance, X-Forwarded-For est lu de
+// droite a gauche : la premiere adresse qui n'est pas un de nos proxies est celle
+// du client, ce qui est a gauche a pu etre invente par lui.
+func ClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		ip = hop
+	}
+	return ip
+}
+
+// Valeur de l'en-tete X-Forwarded-* si la requete vient d'un proxy de confiance.
+// Un proxy qui ajoute sa valeur a celle recue la met en dernier.
+func forwardedHeader(r *http.Request, name string) string {
+	if !isTrustedProxy(remoteIP(r)) {
+		return ""
+	}
+	values := strings.Split(r.Header.Get(name), ",")
+	return strings.TrimSpace(values[len(values)-1])
+}
+
+// La requete est arrivee en HTTPS, directement ou jusqu'au proxy
+func IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return strings.EqualFold(forwardedHeader(r, "X-Forwarded-Proto"), "https")
+}
+
+// Nom d'hote demande par le navigateur, meme si le proxy a reecrit Host
+func RequestHost(r *http.Request) string {
+	if host := forwardedHeader(r, "X-Forwarded-Host"); host != "" {
+		return host
+	}
+	return r.Host
+}
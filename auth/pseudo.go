@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const PseudoMinLength = 3
+const PseudoMaxLength = 20
+
+// Noms qui pourraient faire croire a un compte officiel
+var reservedPseudos = []string{
+	"admin", "administrateur", "administrator", "moderateur", "moderator", "modo",
+	"system", "systeme", "root", "support", "staff", "officiel", "official",
+	"groupietracker", "groupie", "invite", "guest", "anonyme", "anonymous",
+	"joueursupprime", "null", "undefined",
+}
+
+// Mots interdits n'importe ou dans le pseudo
+var blockedWords = []string{
+	"connard", "connasse", "salope", "encule", "enfoire", "batard", "pedophile",
+	"nazi", "hitler", "fuck", "bitch", "nigger", "whore",
+}
+
+// Caracteres d'autres alphabets visuellement identiques a des lettres latines,
+// chiffres utilises comme lettres et lettres accentuees
+var confusables = map[rune]string{
+	// Cyrillique
+	'а': "a", 'в': "b", 'е': "e", 'ё': "e", 'к': "k", 'м': "m", 'н': "h", 'о': "o", 'р': "p",
+	'с': "c", 'т': "t", 'у': "y", 'х': "x", 'і': "l", 'ї': "l", 'ј': "j", 'ѕ': "s", 'ԁ': "d",
+	'ԛ': "q", 'ԝ': "w", 'ъ': "b", 'ь': "b",
+	// Grec
+	'α': "a", 'β': "b", 'ε': "e", 'η': "n", 'ι': "l", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ω': "w", 'ζ': "z", 'μ': "u",
+	// Chiffres et I/l/i, indiscernables selon la police
+	'0': "o", '1': "l", '3': "e", '4': "a", '5': "s", '7': "t", '8': "b", 'i': "l",
+	// Accents
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "l", 'í': "l", 'î': "l", 'ï': "l", 'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'œ': "oe",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y", 'ß': "ss",
+}
+
+// Sequences qui ressemblent a une autre lettre une fois collees
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+func isPseudoSeparator(r rune) bool {
+	return r == '_' || r == '-' || r == '.'
+}
+
+func ValidatePseudo(pseudo string) error {
+	if pseudo == "" {
+		return errors.New("le pseudo ne peut pas etre vide")
+	}
+
+	if !utf8.ValidString(pseudo) {
+		return errors.New("le pseudo contient des caracteres invalides")
+	}
+
+	length := utf8.RuneCountInString(pseudo)
+	if length < PseudoMinLength || length > PseudoMaxLength {
+		return fmt.Errorf("le pseudo doit contenir entre %d et %d caracteres", PseudoMinLength, PseudoMaxLength)
+	}
+
+	first, _ := utf8.DecodeRuneInString(pseudo)
+	if !unicode.IsUpper(first) {
+		return errors.New("le pseudo doit commencer par une majuscule")
+	}
+
+	// Lettres (y compris accentuees, precomposees), chiffres et _ - .
+	// Les accents combinants sont refuses : "e" + accent s'affiche comme "é" sans etre le meme texte
+	scripts := make(map[string]bool)
+	for _, r := range pseudo {
+		switch {
+		case unicode.IsLetter(r):
+			scripts[letterScript(r)] = true
+		case unicode.IsDigit(r), isPseudoSeparator(r):
+		case unicode.Is(unicode.Mn, r):
+			return errors.New("le pseudo contient un accent separe de sa lettre, retape-le")
+		default:
+			return errors.New("le pseudo ne peut contenir que des lettres, des chiffres et _ - .")
+		}
+	}
+
+	if len(scripts) > 1 {
+		return errors.New("le pseudo ne peut pas melanger plusieurs alphabets")
+	}
+
+	key := PseudoKey(pseudo)
+	for _, reserved := range reservedPseudos {
+		if key == PseudoKey(reserved) {
+			return errors.New("ce pseudo est reserve")
+		}
+	}
+	for _, word := range blockedWords {
+		if strings.Contains(key, PseudoKey(word)) {
+			return errors.New("ce pseudo n'est pas autorise")
+		}
+	}
+
+	return nil
+}
+
+func letterScript(r rune) string {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "cyrillic"
+	case unicode.Is(unicode.Greek, r):
+		return "greek"
+	}
+	return "other"
+}
+
+// Forme canonique d'un pseudo pour l'unicite : insensible a la casse, aux accents,
+// aux separateurs et aux caracteres qui se ressemblent ("Max", "MAX", "M4x", "Мах")
+func PseudoKey(pseudo string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(pseudo) {
+		if isPseudoSeparator(r) {
+			continue
+		}
+		if replacement, ok := confusables[r]; ok {
+			b.WriteString(replacement)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return confusableSequences.Replace(b.String())
+}
+
+var ErrPseudoTaken = errors.New("ce pseudo est deja utilise ou trop proche d'un pseudo existant")
+
+// Verifie qu'aucun autre compte n'a un pseudo identique ou trop ressemblant
+func CheckPseudoAvailable(db *sql.DB, pseudo string, excludeUserID int) error {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM users WHERE pseudo_key = ? AND id != ?
+	`, PseudoKey(pseudo), excludeUserID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrPseudoTaken
+	}
+	return nil
+}
+
+// Calcule pseudo_key pour les comptes crees avant son ajout. Un compte dont le
+// pseudo est deja pris par un autre est renomme avec un suffixe numerique.
+func BackfillPseudoKeys(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, pseudo FROM users WHERE pseudo_key IS NULL AND deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return err
+	}
+
+	type legacyUser struct {
+		id     int
+		pseudo string
+	}
+	var users []legacyUser
+	for rows.Next() {
+		var user legacyUser
+		if err := rows.Scan(&user.id, &user.pseudo); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+
+	for _, user := range users {
+		pseudo := user.pseudo
+		for i := 2; CheckPseudoAvailable(db, pseudo, user.id) != nil; i++ {
+			pseudo = fmt.Sprintf("%s%d", user.pseudo, i)
+		}
+		if pseudo != user.pseudo {
+			log.Printf("Pseudo %q deja pris, compte %d renomme en %q", user.pseudo, user.id, pseudo)
+		}
+
+		if _, err := db.Exec("UPDATE users SET pseudo = ?, pseudo_key = ? WHERE id = ?", pseudo, PseudoKey(pseudo), user.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,16 +1,20 @@
 package auth
 
 import (
-	"database/sql"
-	"html/template"
+	"errors"
+	"log"
 	"net/http"
+
+	"groupie-tracker/mailer"
 )
 
-func RegisterHandler(db *sql.DB) http.HandlerFunc {
+// Retourne par UserStore.Create quand l'index unique sur pseudo_key ou email refuse le compte
+var ErrAccountTaken = errors.New("pseudo ou email deja utilise")
+
+func RegisterHandler(accounts Accounts, m mailer.Mailer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
-			tmpl := template.Must(template.ParseFiles("templates/register.html"))
-			tmpl.Execute(w, nil)
+			Templates.Render(w, r, "register.html", nil)
 			return
 		}
 
@@ -25,6 +29,11 @@ func RegisterHandler(db *sql.DB) http.HandlerFunc {
 				return
 			}
 
+			if err := accounts.Users.CheckPseudoAvailable(pseudo, 0); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+
 			if err := ValidateEmail(email); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
@@ -46,17 +55,25 @@ func RegisterHandler(db *sql.DB) http.HandlerFunc {
 				return
 			}
 
-			_, err = db.Exec(
-				"INSERT INTO users (pseudo, email, password_hash) VALUES (?, ?, ?)",
-				pseudo, email, hashedPassword,
-			)
+			user, err := accounts.Users.Create(pseudo, email, hashedPassword)
 
-			if err != nil {
+			// Deux inscriptions simultanees passent toutes deux CheckPseudoAvailable :
+			// l'index unique sur pseudo_key tranche
+			if errors.Is(err, ErrAccountTaken) {
 				http.Error(w, "Pseudo ou email deja utilise", http.StatusConflict)
 				return
 			}
+			if err != nil {
+				log.Printf("Erreur inscription: %v", err)
+				http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+				return
+			}
+
+			if err := SendVerificationEmail(accounts.EmailTokens, m, *user, BaseURL(r)); err != nil {
+				log.Printf("Erreur envoi mail de verification: %v", err)
+			}
 
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			http.Redirect(w, r, "/login?registered=1", http.StatusSeeOther)
 		}
 	}
 }
\ No newline at end of file
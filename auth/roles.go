@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Chaque role a aussi les droits des roles inferieurs
+var roleLevels = map[string]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+func HasRole(userRole string, required string) bool {
+	level, ok := roleLevels[userRole]
+	if !ok {
+		return false
+	}
+	return level >= roleLevels[required]
+}
+
+func RequireRole(sessions SessionValidator, role string, next http.HandlerFunc) http.HandlerFunc {
+	return AuthMiddleware(sessions, func(w http.ResponseWriter, r *http.Request) {
+		if !HasRole(GetUserRole(r), role) {
+			http.Error(w, "Acces refuse", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func GetUserRole(r *http.Request) string {
+	role, ok := r.Context().Value(UserRoleKey).(string)
+	if !ok {
+		return RoleUser
+	}
+	return role
+}
+
+func IsBanned(db *sql.DB, userID int) (bool, error) {
+	var banned bool
+	err := db.QueryRow("SELECT banned_at IS NOT NULL FROM users WHERE id = ?", userID).Scan(&banned)
+	return banned, err
+}
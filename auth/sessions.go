@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func SessionsHandler(sessions SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := GetUserID(r)
+		currentSessionID := GetSessionID(r)
+
+		if r.Method == "POST" {
+			switch r.FormValue("action") {
+			case "revoke":
+				sessionID, err := strconv.Atoi(r.FormValue("session_id"))
+				if err != nil {
+					http.Error(w, "Session invalide", http.StatusBadRequest)
+					return
+				}
+
+				if err := sessions.DeleteForUser(userID, sessionID); err != nil {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+
+				if sessionID == currentSessionID {
+					http.Redirect(w, r, "/login", http.StatusSeeOther)
+					return
+				}
+
+			case "revoke_others":
+				if err := sessions.DeleteOthers(userID, currentSessionID); err != nil {
+					http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+					return
+				}
+
+			default:
+				http.Error(w, "Action inconnue", http.StatusBadRequest)
+				return
+			}
+
+			http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+			return
+		}
+
+		list, err := sessions.ListForUser(userID)
+		if err != nil {
+			http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Pseudo           string
+			Sessions         []Session
+			CurrentSessionID int
+		}{
+			Pseudo:           GetUserPseudo(r),
+			Sessions:         list,
+			CurrentSessionID: currentSessionID,
+		}
+
+		Templates.Render(w, r, "sessions.html", data)
+	}
+}
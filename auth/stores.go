@@ -0,0 +1,59 @@
+package auth
+
+import "time"
+
+// Donnees utilisees par les handlers de compte, fournies par store.Stores.Accounts.
+// Les fonctions de ce paquet qui prennent un *sql.DB servent a l'implementation SQL.
+type Accounts struct {
+	Users         UserStore
+	Sessions      SessionStore
+	LoginAttempts LoginAttemptStore
+	EmailTokens   EmailTokenStore
+}
+
+// Les comptes supprimes (anonymises) ne sont plus retrouvables
+type UserStore interface {
+	Create(pseudo string, email string, passwordHash string) (*User, error)
+	GetByID(id int) (*User, error)
+	// Compte dont le pseudo ou l'adresse mail vaut identifier
+	GetByLogin(identifier string) (*User, error)
+	GetByEmail(email string) (*User, error)
+	CheckPseudoAvailable(pseudo string, excludeUserID int) error
+	SetPseudo(userID int, pseudo string) error
+	SetPendingEmail(userID int, email string) error
+	// Remplace l'adresse par celle en attente, qui devient confirmee
+	ConfirmPendingEmail(userID int) error
+	MarkEmailVerified(userID int) error
+	SetPassword(userID int, passwordHash string) error
+	// Change le mot de passe, ferme toutes les sessions et confirme l'adresse
+	ResetPassword(userID int, passwordHash string) error
+	ConvertGuest(userID int, email string, passwordHash string) error
+	Delete(userID int) error
+}
+
+// Les jetons manipules ici sont les jetons en clair du cookie
+type SessionStore interface {
+	Create(userID int, userAgent string, ipAddress string, rememberMe bool) (string, error)
+	Delete(token string) error
+	// Sessions non expirees, la plus recemment utilisee d'abord
+	ListForUser(userID int) ([]Session, error)
+	DeleteForUser(userID int, sessionID int) error
+	DeleteOthers(userID int, keepSessionID int) error
+}
+
+// identifier est deja normalise (voir normalizeIdentifier)
+type LoginAttemptStore interface {
+	Record(identifier string, userID int, ipAddress string, success bool) error
+	// Echecs depuis since et depuis la derniere connexion reussie du compte,
+	// designe par userID s'il existe, sinon par identifier
+	AccountFailures(identifier string, userID int, since time.Time) (LoginFailures, error)
+	// Echecs depuis since, qu'une connexion reussie ne remet pas a zero
+	IPFailures(ipAddress string, since time.Time) (LoginFailures, error)
+}
+
+type EmailTokenStore interface {
+	Create(userID int, purpose string, duration time.Duration) (string, error)
+	Consume(token string, purpose string) (int, error)
+	Check(token string, purpose string) bool
+	CreatedSince(userID int, purpose string, since time.Time) (bool, error)
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const failureWindow = 15 * time.Minute
+const lockoutDuration = 15 * time.Minute
+const maxBackoff = time.Minute
+
+// Compte : attente de 1s, 2s, 4s, 8s apres chaque echec puis blocage apres 5 echecs
+const accountFreeFailures = 0
+const accountMaxFailures = 5
+
+// IP : 10 echecs libres (plusieurs comptes derriere la meme box) puis attente croissante
+const ipFreeFailures = 10
+const ipMaxFailures = 30
+
+// Hash factice compare quand le compte n'existe pas, pour que la reponse
+// prenne le meme temps et ne revele pas l'existence du compte. Calcule au
+// premier usage pour reprendre le BcryptCost de la configuration.
+var dummyPasswordHash []byte
+var dummyPasswordOnce sync.Once
+
+func CheckPasswordOrDummy(password string, hash string) bool {
+	if hash == "" {
+		dummyPasswordOnce.Do(func() {
+			dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("groupie-tracker-dummy-password"), BcryptCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return CheckPassword(password, hash)
+}
+
+func normalizeIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func RecordLoginAttempt(db *sql.DB, identifier string, userID int, ipAddress string, success bool) error {
+	var user interface{}
+	if userID != 0 {
+		user = userID
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO login_attempts (identifier, user_id, ip_address, success)
+		VALUES (?, ?, ?, ?)
+	`, normalizeIdentifier(identifier), user, ipAddress, success)
+
+	return err
+}
+
+// Echecs de connexion pris en compte pour un compte ou une IP
+type LoginFailures struct {
+	Count int
+	Last  time.Time
+}
+
+// Retourne le temps a attendre avant la prochaine tentative (0 si autorisee)
+func LoginRetryAfter(attempts LoginAttemptStore, identifier string, userID int, ipAddress string) (time.Duration, error) {
+	since := time.Now().UTC().Add(-failureWindow)
+
+	accountFailures, err := attempts.AccountFailures(normalizeIdentifier(identifier), userID, since)
+	if err != nil {
+		return 0, err
+	}
+
+	// Une connexion reussie ne remet pas le compteur IP a zero : sinon un attaquant
+	// pourrait se connecter a son propre compte entre deux series d'essais
+	ipFailures, err := attempts.IPFailures(ipAddress, since)
+	if err != nil {
+		return 0, err
+	}
+
+	accountWait := accountFailures.wait(accountFreeFailures, accountMaxFailures)
+	ipWait := ipFailures.wait(ipFreeFailures, ipMaxFailures)
+	if ipWait > accountWait {
+		return ipWait, nil
+	}
+	return accountWait, nil
+}
+
+func (f LoginFailures) wait(freeFailures int, maxFailures int) time.Duration {
+	if f.Count <= freeFailures {
+		return 0
+	}
+
+	var delay time.Duration
+	if f.Count >= maxFailures {
+		delay = lockoutDuration
+	} else {
+		delay = time.Second << uint(f.Count-freeFailures-1)
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+
+	wait := time.Until(f.Last.Add(delay))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func AccountLoginFailures(db *sql.DB, identifier string, userID int, since time.Time) (LoginFailures, error) {
+	if userID != 0 {
+		return loginFailures(db, "user_id", userID, since, true)
+	}
+	return loginFailures(db, "identifier", normalizeIdentifier(identifier), since, true)
+}
+
+func IPLoginFailures(db *sql.DB, ipAddress string, since time.Time) (LoginFailures, error) {
+	return loginFailures(db, "ip_address", ipAddress, since, false)
+}
+
+// column est toujours une constante interne (identifier, user_id ou ip_address)
+func loginFailures(db *sql.DB, column string, value interface{}, since time.Time, resetOnSuccess bool) (LoginFailures, error) {
+	var failures LoginFailures
+
+	lastSuccessFilter := "0"
+	if resetOnSuccess {
+		lastSuccessFilter = "(SELECT MAX(id) FROM login_attempts WHERE " + column + " = ? AND success = 1)"
+	}
+
+	args := []interface{}{value, since}
+	if resetOnSuccess {
+		args = append(args, value)
+	}
+
+	where := `
+		FROM login_attempts
+		WHERE ` + column + ` = ? AND success = 0
+			AND created_at >= ?
+			AND id > COALESCE(` + lastSuccessFilter + `, 0)
+	`
+	if err := db.QueryRow("SELECT COUNT(*)"+where, args...).Scan(&failures.Count); err != nil {
+		return failures, err
+	}
+	if failures.Count == 0 {
+		return failures, nil
+	}
+
+	// Requete separee : les pilotes ne savent pas lire un MAX(created_at) en time.Time
+	err := db.QueryRow("SELECT created_at"+where+"ORDER BY id DESC LIMIT 1", args...).Scan(&failures.Last)
+	return failures, err
+}
@@ -0,0 +1,413 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Reglages du serveur. Chaque champ peut venir, du moins au plus prioritaire :
+// de la valeur par defaut, du fichier YAML (config.yaml ou -config), de la
+// variable d'environnement indiquee par le tag env, puis du flag du meme nom
+// que le chemin YAML (-server.addr, -game.max_players...).
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Mail      MailConfig      `yaml:"mail"`
+	OIDC      OIDCConfig      `yaml:"oidc"`
+	Game      GameConfig      `yaml:"game"`
+	Deezer    DeezerConfig    `yaml:"deezer"`
+	WebSocket WebSocketConfig `yaml:"websocket"`
+}
+
+type ServerConfig struct {
+	Addr         string `yaml:"addr" env:"GROUPIE_ADDR" usage:"adresse d'ecoute HTTP"`
+	PublicURL    string `yaml:"public_url" env:"GROUPIE_PUBLIC_URL" usage:"adresse publique du site, utilisee dans les liens des mails"`
+	TemplatesDir string `yaml:"templates_dir" env:"GROUPIE_TEMPLATES_DIR" usage:"dossier des templates HTML (vide : ceux embarques dans le binaire)"`
+	StaticDir    string `yaml:"static_dir" env:"GROUPIE_STATIC_DIR" usage:"dossier des fichiers statiques (vide : ceux embarques dans le binaire)"`
+	Dev          bool   `yaml:"dev" env:"GROUPIE_DEV" usage:"relit les templates a chaque page, depuis ./templates et ./static par defaut"`
+	AdminPseudo  string `yaml:"admin_pseudo" env:"GROUPIE_ADMIN_PSEUDO" usage:"compte promu administrateur au demarrage"`
+
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"GROUPIE_SHUTDOWN_TIMEOUT" usage:"delai laisse aux requetes et aux WebSockets pour se terminer a l'arret"`
+
+	TLSCert        string        `yaml:"tls_cert" env:"GROUPIE_TLS_CERT" usage:"certificat PEM (vide : HTTP seul)"`
+	TLSKey         string        `yaml:"tls_key" env:"GROUPIE_TLS_KEY" usage:"cle privee PEM du certificat"`
+	RedirectAddr   string        `yaml:"redirect_addr" env:"GROUPIE_REDIRECT_ADDR" usage:"adresse d'ecoute HTTP qui redirige vers HTTPS (vide : desactivee)"`
+	HSTSMaxAge     time.Duration `yaml:"hsts_max_age" env:"GROUPIE_HSTS_MAX_AGE" usage:"duree de l'en-tete Strict-Transport-Security en HTTPS (0 : pas d'en-tete)"`
+	TrustedProxies string        `yaml:"trusted_proxies" env:"GROUPIE_TRUSTED_PROXIES" usage:"IP ou CIDR des reverse proxies dont on lit les en-tetes X-Forwarded-*, separes par des virgules"`
+}
+
+// Le serveur ecoute lui-meme en HTTPS
+func (s ServerConfig) TLS() bool {
+	return s.TLSCert != ""
+}
+
+// Reseaux de server.trusted_proxies ; une IP seule donne un reseau /32 ou /128
+func (s ServerConfig) TrustedProxyNets() ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(s.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("adresse de proxy invalide %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("reseau de proxy invalide %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+type DatabaseConfig struct {
+	Driver         string        `yaml:"driver" env:"GROUPIE_DB_DRIVER" usage:"sqlite ou postgres"`
+	URL            string        `yaml:"url" env:"GROUPIE_DATABASE_URL" usage:"fichier SQLite ou URL PostgreSQL"`
+	BackupDir      string        `yaml:"backup_dir" env:"GROUPIE_BACKUP_DIR" usage:"dossier des sauvegardes periodiques (vide : desactivees)"`
+	BackupInterval time.Duration `yaml:"backup_interval" env:"GROUPIE_BACKUP_INTERVAL" usage:"intervalle entre deux sauvegardes"`
+	BackupKeep     int           `yaml:"backup_keep" env:"GROUPIE_BACKUP_KEEP" usage:"nombre de sauvegardes conservees"`
+}
+
+type AuthConfig struct {
+	SessionTTL      time.Duration `yaml:"session_ttl" env:"GROUPIE_SESSION_TTL" usage:"duree d'une session"`
+	RememberMeTTL   time.Duration `yaml:"remember_me_ttl" env:"GROUPIE_REMEMBER_ME_TTL" usage:"duree d'une session \"Se souvenir de moi\""`
+	GuestSessionTTL time.Duration `yaml:"guest_session_ttl" env:"GROUPIE_GUEST_SESSION_TTL" usage:"duree d'une session invite"`
+	BcryptCost      int           `yaml:"bcrypt_cost" env:"GROUPIE_BCRYPT_COST" usage:"cout bcrypt des mots de passe"`
+}
+
+type MailConfig struct {
+	From         string `yaml:"from" env:"GROUPIE_MAIL_FROM" usage:"expediteur des mails"`
+	SMTPHost     string `yaml:"smtp_host" env:"GROUPIE_SMTP_HOST" usage:"serveur SMTP (vide : mails ecrits dans log_file)"`
+	SMTPPort     int    `yaml:"smtp_port" env:"GROUPIE_SMTP_PORT" usage:"port SMTP"`
+	SMTPUsername string `yaml:"smtp_username" env:"GROUPIE_SMTP_USERNAME" usage:"identifiant SMTP"`
+	SMTPPassword string `yaml:"smtp_password" env:"GROUPIE_SMTP_PASSWORD" usage:"mot de passe SMTP"`
+	LogFile      string `yaml:"log_file" env:"GROUPIE_MAIL_LOG" usage:"fichier des mails en developpement"`
+}
+
+type OIDCConfig struct {
+	Issuer       string `yaml:"issuer" env:"GROUPIE_OIDC_ISSUER" usage:"fournisseur OpenID Connect"`
+	ClientID     string `yaml:"client_id" env:"GROUPIE_OIDC_CLIENT_ID" usage:"identifiant client OIDC"`
+	ClientSecret string `yaml:"client_secret" env:"GROUPIE_OIDC_CLIENT_SECRET" usage:"secret client OIDC"`
+	Name         string `yaml:"name" env:"GROUPIE_OIDC_NAME" usage:"nom du fournisseur affiche sur la page de connexion"`
+	Mock         bool   `yaml:"mock" env:"GROUPIE_OIDC_MOCK" usage:"active le fournisseur de test sous /oidc-mock (developpement uniquement, exige server.dev)"`
+}
+
+type GameConfig struct {
+	MaxPlayers            int    `yaml:"max_players" env:"GROUPIE_MAX_PLAYERS" usage:"nombre maximum de joueurs par salle"`
+	BlindTestPlaylist     string `yaml:"blindtest_playlist" env:"GROUPIE_BLINDTEST_PLAYLIST" usage:"playlist par defaut du blind test (Rock, Rap, Pop)"`
+	BlindTestResponseTime int    `yaml:"blindtest_response_time" env:"GROUPIE_BLINDTEST_RESPONSE_TIME" usage:"temps de reponse par defaut du blind test, en secondes"`
+	BlindTestRounds       int    `yaml:"blindtest_rounds" env:"GROUPIE_BLINDTEST_ROUNDS" usage:"nombre de manches par defaut du blind test"`
+	PetitBacRounds        int    `yaml:"petitbac_rounds" env:"GROUPIE_PETITBAC_ROUNDS" usage:"nombre de manches par defaut du petit bac"`
+}
+
+type DeezerConfig struct {
+	BaseURL string        `yaml:"base_url" env:"GROUPIE_DEEZER_BASE_URL" usage:"URL de l'API Deezer"`
+	Timeout time.Duration `yaml:"timeout" env:"GROUPIE_DEEZER_TIMEOUT" usage:"delai maximum d'une requete Deezer"`
+}
+
+type WebSocketConfig struct {
+	ReadBufferSize  int   `yaml:"read_buffer_size" env:"GROUPIE_WS_READ_BUFFER_SIZE" usage:"taille du tampon de lecture WebSocket"`
+	WriteBufferSize int   `yaml:"write_buffer_size" env:"GROUPIE_WS_WRITE_BUFFER_SIZE" usage:"taille du tampon d'ecriture WebSocket"`
+	MaxMessageSize  int64 `yaml:"max_message_size" env:"GROUPIE_WS_MAX_MESSAGE_SIZE" usage:"taille maximum d'un message recu, en octets"`
+	SendQueueSize   int   `yaml:"send_queue_size" env:"GROUPIE_WS_SEND_QUEUE_SIZE" usage:"messages en attente par client avant deconnexion"`
+}
+
+// Fichier lu s'il existe, quand ni -config ni GROUPIE_CONFIG_FILE ne sont donnes
+const DefaultFile = "config.yaml"
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr: ":8080",
+
+			ShutdownTimeout: 10 * time.Second,
+			HSTSMaxAge:      365 * 24 * time.Hour,
+		},
+		Database: DatabaseConfig{
+			Driver:         "sqlite",
+			URL:            "groupie_tracker.db",
+			BackupInterval: 24 * time.Hour,
+			BackupKeep:     7,
+		},
+		Auth: AuthConfig{
+			SessionTTL:      24 * time.Hour,
+			RememberMeTTL:   30 * 24 * time.Hour,
+			GuestSessionTTL: 6 * time.Hour,
+			BcryptCost:      12,
+		},
+		Mail: MailConfig{
+			From:     "Groupie Tracker <no-reply@groupie-tracker.local>",
+			SMTPPort: 587,
+			LogFile:  "mails.log",
+		},
+		Game: GameConfig{
+			MaxPlayers:            10,
+			BlindTestPlaylist:     "Pop",
+			BlindTestResponseTime: 37,
+			BlindTestRounds:       10,
+			PetitBacRounds:        9,
+		},
+		Deezer: DeezerConfig{
+			BaseURL: "https://api.deezer.com",
+			Timeout: 10 * time.Second,
+		},
+		WebSocket: WebSocketConfig{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			MaxMessageSize:  4096,
+			SendQueueSize:   256,
+		},
+	}
+}
+
+// Charge la configuration et renvoie les arguments restants (sous-commande
+// migrate, backup...). Les flags doivent preceder la sous-commande.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	fields := collectFields(reflect.ValueOf(cfg).Elem(), "")
+
+	flags := flag.NewFlagSet("groupie-tracker", flag.ContinueOnError)
+	configFile := flags.String("config", "", "fichier de configuration YAML (defaut: "+DefaultFile+" s'il existe)")
+	flagValues := make(map[string]*flagValue, len(fields))
+	for _, f := range fields {
+		flagValues[f.path] = &flagValue{raw: f.String(), isBool: f.value.Kind() == reflect.Bool}
+		flags.Var(flagValues[f.path], f.path, f.usage+" ("+f.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("GROUPIE_CONFIG_FILE")
+	}
+	if err := loadFile(cfg, path); err != nil {
+		return nil, nil, err
+	}
+
+	for _, f := range fields {
+		if value := os.Getenv(f.env); value != "" {
+			if err := f.Set(value); err != nil {
+				return nil, nil, fmt.Errorf("variable %s: %w", f.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	flags.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.path == fl.Name && flagErr == nil {
+				if err := f.Set(flagValues[f.path].raw); err != nil {
+					flagErr = fmt.Errorf("flag -%s: %w", f.path, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFile
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Une cle inconnue est presque toujours une faute de frappe : on refuse
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("fichier %s: %w", path, err)
+	}
+	return nil
+}
+
+// Verifie toute la configuration et signale toutes les erreurs d'un coup
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr ne peut pas etre vide")
+	check(c.Server.PublicURL == "" || isHTTPURL(c.Server.PublicURL), "server.public_url doit etre une URL http(s) absolue: %q", c.Server.PublicURL)
+	check(c.Server.TemplatesDir == "" || isDir(c.Server.TemplatesDir), "server.templates_dir n'est pas un dossier: %q", c.Server.TemplatesDir)
+	check(c.Server.StaticDir == "" || isDir(c.Server.StaticDir), "server.static_dir n'est pas un dossier: %q", c.Server.StaticDir)
+	check(c.Server.ShutdownTimeout >= time.Second, "server.shutdown_timeout doit etre d'au moins 1s: %s", c.Server.ShutdownTimeout)
+	check((c.Server.TLSCert == "") == (c.Server.TLSKey == ""), "server.tls_cert et server.tls_key vont ensemble")
+	check(c.Server.TLSCert == "" || isFile(c.Server.TLSCert), "server.tls_cert introuvable: %q", c.Server.TLSCert)
+	check(c.Server.TLSKey == "" || isFile(c.Server.TLSKey), "server.tls_key introuvable: %q", c.Server.TLSKey)
+	check(c.Server.RedirectAddr == "" || c.Server.TLS(), "server.redirect_addr demande server.tls_cert et server.tls_key")
+	check(c.Server.RedirectAddr == "" || c.Server.RedirectAddr != c.Server.Addr, "server.redirect_addr doit differer de server.addr")
+	check(c.Server.HSTSMaxAge >= 0, "server.hsts_max_age ne peut pas etre negatif: %s", c.Server.HSTSMaxAge)
+	if _, err := c.Server.TrustedProxyNets(); err != nil {
+		check(false, "server.trusted_proxies: %v", err)
+	}
+
+	check(c.Database.Driver == "sqlite" || c.Database.Driver == "postgres", "database.driver doit valoir sqlite ou postgres: %q", c.Database.Driver)
+	check(c.Database.URL != "", "database.url ne peut pas etre vide")
+	check(c.Database.Driver != "postgres" || c.Database.URL != Default().Database.URL, "database.url (GROUPIE_DATABASE_URL) doit donner l'URL PostgreSQL")
+	check(c.Database.BackupInterval >= time.Minute, "database.backup_interval doit etre d'au moins 1m: %s", c.Database.BackupInterval)
+	check(c.Database.BackupKeep >= 1, "database.backup_keep doit etre positif: %d", c.Database.BackupKeep)
+
+	check(c.Auth.SessionTTL >= time.Minute, "auth.session_ttl doit etre d'au moins 1m: %s", c.Auth.SessionTTL)
+	check(c.Auth.RememberMeTTL >= c.Auth.SessionTTL, "auth.remember_me_ttl doit etre superieur a auth.session_ttl")
+	check(c.Auth.GuestSessionTTL >= time.Minute, "auth.guest_session_ttl doit etre d'au moins 1m: %s", c.Auth.GuestSessionTTL)
+	check(c.Auth.BcryptCost >= 10 && c.Auth.BcryptCost <= bcrypt.MaxCost, "auth.bcrypt_cost doit etre entre 10 et %d: %d", bcrypt.MaxCost, c.Auth.BcryptCost)
+
+	check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort <= 65535, "mail.smtp_port invalide: %d", c.Mail.SMTPPort)
+	check(c.Mail.SMTPHost != "" || c.Mail.LogFile != "", "mail.log_file est requis sans mail.smtp_host")
+
+	check(c.OIDC.Issuer == "" || c.OIDC.Mock || c.OIDC.ClientID != "", "oidc.client_id est requis avec oidc.issuer")
+	// Le fournisseur de test connecte n'importe qui sous n'importe quelle adresse
+	check(!c.OIDC.Mock || c.Server.Dev, "oidc.mock n'est accepte qu'avec server.dev")
+
+	check(c.Game.MaxPlayers >= 2 && c.Game.MaxPlayers <= 100, "game.max_players doit etre entre 2 et 100: %d", c.Game.MaxPlayers)
+	check(c.Game.BlindTestPlaylist == "Rock" || c.Game.BlindTestPlaylist == "Rap" || c.Game.BlindTestPlaylist == "Pop", "game.blindtest_playlist doit valoir Rock, Rap ou Pop: %q", c.Game.BlindTestPlaylist)
+	check(c.Game.BlindTestResponseTime >= 5, "game.blindtest_response_time doit etre d'au moins 5 secondes: %d", c.Game.BlindTestResponseTime)
+	check(c.Game.BlindTestRounds >= 1, "game.blindtest_rounds doit etre positif: %d", c.Game.BlindTestRounds)
+	check(c.Game.PetitBacRounds >= 1, "game.petitbac_rounds doit etre positif: %d", c.Game.PetitBacRounds)
+
+	check(isHTTPURL(c.Deezer.BaseURL), "deezer.base_url doit etre une URL http(s) absolue: %q", c.Deezer.BaseURL)
+	check(c.Deezer.Timeout > 0, "deezer.timeout doit etre positif: %s", c.Deezer.Timeout)
+
+	check(c.WebSocket.ReadBufferSize > 0, "websocket.read_buffer_size doit etre positif: %d", c.WebSocket.ReadBufferSize)
+	check(c.WebSocket.WriteBufferSize > 0, "websocket.write_buffer_size doit etre positif: %d", c.WebSocket.WriteBufferSize)
+	check(c.WebSocket.MaxMessageSize >= 512, "websocket.max_message_size doit etre d'au moins 512: %d", c.WebSocket.MaxMessageSize)
+	check(c.WebSocket.SendQueueSize > 0, "websocket.send_queue_size doit etre positif: %d", c.WebSocket.SendQueueSize)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("configuration invalide:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// Un champ de la configuration avec son chemin YAML (qui sert aussi de nom de flag)
+type field struct {
+	path  string
+	env   string
+	usage string
+	value reflect.Value
+}
+
+func collectFields(v reflect.Value, prefix string) []field {
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name := sf.Tag.Get("yaml")
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+			fields = append(fields, collectFields(v.Field(i), name)...)
+			continue
+		}
+		fields = append(fields, field{path: name, env: sf.Tag.Get("env"), usage: sf.Tag.Get("usage"), value: v.Field(i)})
+	}
+	return fields
+}
+
+func (f field) String() string {
+	if d, ok := f.value.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+func (f field) Set(raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if f.value.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("duree invalide %q (ex: 30s, 15m, 24h)", raw)
+		}
+		f.value.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("nombre invalide %q", raw)
+		}
+		f.value.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("booleen invalide %q (1, 0, true, false)", raw)
+		}
+		f.value.SetBool(b)
+	default:
+		return fmt.Errorf("type non gere: %s", f.value.Kind())
+	}
+	return nil
+}
+
+// Valeur brute d'un flag, appliquee apres le fichier et l'environnement
+type flagValue struct {
+	raw    string
+	isBool bool
+}
+
+func (v *flagValue) String() string     { return v.raw }
+func (v *flagValue) Set(s string) error { v.raw = s; return nil }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Pages copiees par etape : entre deux etapes les parties en cours peuvent ecrire
+const backupStepPages = 256
+const backupStepPause = 10 * time.Millisecond
+
+const backupFilePrefix = "groupie_tracker-"
+const backupFileSuffix = ".db"
+
+var ErrBackupUnsupported = errors.New("sauvegarde en ligne disponible uniquement avec SQLite (utiliser pg_dump pour PostgreSQL)")
+
+// Copie la base dans destPath pendant que le serveur tourne, via l'API de
+// sauvegarde de SQLite. Le fichier est ecrit a cote puis renomme : une
+// sauvegarde interrompue ne laisse jamais de fichier incomplet a destPath.
+func Backup(db *sql.DB, destPath string) error {
+	if DialectOf(db) != SQLite {
+		return ErrBackupUnsupported
+	}
+
+	tmpPath := destPath + ".tmp"
+	os.Remove(tmpPath)
+
+	if err := backupTo(db, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+func backupTo(db *sql.DB, destPath string) error {
+	ctx := context.Background()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			dest, ok := destRaw.(*sqlite3.SQLiteConn)
+			src, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return ErrBackupUnsupported
+			}
+
+			backup, err := dest.Backup("main", src, "main")
+			if err != nil {
+				return err
+			}
+
+			for {
+				done, err := backup.Step(backupStepPages)
+				if err != nil {
+					backup.Close()
+					return err
+				}
+				if done {
+					break
+				}
+				time.Sleep(backupStepPause)
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// Sauvegarde horodatee dans dir, puis suppression des plus anciennes au-dela de keep
+func RotateBackup(db *sql.DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, backupFilePrefix+time.Now().UTC().Format("20060102-150405")+backupFileSuffix)
+	if err := Backup(db, path); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return path, err
+	}
+
+	// Le nom contient la date : l'ordre alphabetique est l'ordre chronologique
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return path, fmt.Errorf("suppression ancienne sauvegarde: %w", err)
+		}
+		backups = backups[1:]
+	}
+
+	return path, nil
+}
+
+func StartBackupSchedule(db *sql.DB, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		path, err := RotateBackup(db, dir, keep)
+		if err != nil {
+			log.Printf("Erreur sauvegarde BDD: %v", err)
+			continue
+		}
+		log.Printf("Sauvegarde BDD ecrite dans %s", path)
+	}
+}
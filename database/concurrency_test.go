@@ -0,0 +1,110 @@
+package database_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+
+	"groupie-tracker/database"
+	"groupie-tracker/game"
+	"groupie-tracker/room"
+	"groupie-tracker/scoreboard"
+)
+
+// Des joueurs rejoignent les memes salles et marquent des points en parallele
+// sur un seul fichier SQLite : aucune ecriture ne doit echouer en SQLITE_BUSY
+// et la limite de joueurs par salle doit tenir.
+func TestConcurrentJoinsAndScores(t *testing.T) {
+	db, err := database.InitDB("sqlite", filepath.Join(t.TempDir(), "concurrency.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const nbPlayers = 30
+	const nbRooms = 3
+	const nbRounds = 10
+
+	var userIDs []int
+	for i := 0; i < nbPlayers; i++ {
+		result, err := db.Exec(
+			"INSERT INTO users (pseudo, pseudo_key, email, password_hash) VALUES (?, ?, ?, '')",
+			fmt.Sprintf("Joueur%d", i), fmt.Sprintf("joueur%d", i), fmt.Sprintf("joueur%d@example.com", i),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		userIDs = append(userIDs, int(id))
+	}
+
+	var rooms []*room.Room
+	for i := 0; i < nbRooms; i++ {
+		created, err := room.CreateRoom(db, "petitbac", userIDs[i], true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rooms = append(rooms, created)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, nbPlayers*(nbRooms+nbRounds+1))
+
+	for _, userID := range userIDs {
+		wg.Add(1)
+		go func(userID int) {
+			defer wg.Done()
+
+			for _, r := range rooms {
+				err := room.JoinRoom(db, r.Code, userID)
+				if err != nil && !errors.Is(err, room.ErrRoomFull) && !errors.Is(err, room.ErrAlreadyJoined) {
+					errs <- fmt.Errorf("joueur %d, salle %s: %w", userID, r.Code, err)
+				}
+			}
+
+			for round := 1; round <= nbRounds; round++ {
+				if err := game.SavePetitBacScore(db, rooms[0].ID, userID, round, 1); err != nil {
+					errs <- fmt.Errorf("joueur %d, manche %d: %w", userID, round, err)
+				}
+			}
+
+			if _, err := scoreboard.GetGameScoreboard(db, rooms[0].ID, "petitbac"); err != nil {
+				errs <- fmt.Errorf("joueur %d, scoreboard: %w", userID, err)
+			}
+		}(userID)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
+			t.Errorf("base verrouillee: %v", err)
+			continue
+		}
+		t.Error(err)
+	}
+
+	for _, r := range rooms {
+		var players int
+		if err := db.QueryRow("SELECT COUNT(*) FROM room_players WHERE room_id = ?", r.ID).Scan(&players); err != nil {
+			t.Fatal(err)
+		}
+		if players != r.MaxPlayers {
+			t.Errorf("salle %s: %d joueurs, attendu %d", r.Code, players, r.MaxPlayers)
+		}
+	}
+
+	var scores int
+	if err := db.QueryRow("SELECT COUNT(*) FROM scores WHERE room_id = ?", rooms[0].ID).Scan(&scores); err != nil {
+		t.Fatal(err)
+	}
+	if scores != nbPlayers*nbRounds {
+		t.Errorf("%d scores enregistres, attendu %d", scores, nbPlayers*nbRounds)
+	}
+}
@@ -2,118 +2,112 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+type Dialect string
 
-func InitDB(dbPath string) error {
-	var err error
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
 
-	DB, err = sql.Open("sqlite3", dbPath)
+// Pour SQLite dataSource est le chemin du fichier, pour PostgreSQL une URL
+// postgres://... ou une chaine "host=... dbname=..."
+func InitDB(driver string, dataSource string) (*sql.DB, error) {
+	db, err := OpenDB(driver, dataSource)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = DB.Ping(); err != nil {
-		return err
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	err = createTables()
-	if err != nil {
-		return err
+	log.Println("Base de donnees initialisee avec succes")
+	return db, nil
+}
+
+// Ouvre la base sans appliquer les migrations (utilise par la commande migrate)
+func OpenDB(driver string, dataSource string) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+
+	switch Dialect(driver) {
+	case SQLite, "":
+		db, err = sql.Open("sqlite3", dsn(dataSource))
+		if err != nil {
+			return nil, err
+		}
+		// WAL : lectures en parallele, mais un seul ecrivain a la fois de toute facon
+		db.SetMaxOpenConns(8)
+		db.SetMaxIdleConns(4)
+	case Postgres:
+		db, err = sql.Open(postgresDriverName, dataSource)
+		if err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(20)
+		db.SetMaxIdleConns(10)
+	default:
+		return nil, fmt.Errorf("pilote de base de donnees inconnu: %s (sqlite ou postgres)", driver)
 	}
+	db.SetConnMaxIdleTime(5 * time.Minute)
 
-	log.Println("Base de donnees initialisee avec succes")
-	return nil
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func createTables() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		pseudo TEXT UNIQUE NOT NULL,
-		email TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS rooms (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		code TEXT UNIQUE NOT NULL,
-		game_type TEXT NOT NULL,
-		host_id INTEGER NOT NULL,
-		max_players INTEGER DEFAULT 10,
-		status TEXT DEFAULT 'waiting',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (host_id) REFERENCES users(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS room_players (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		room_id INTEGER NOT NULL,
-		user_id INTEGER NOT NULL,
-		joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (room_id) REFERENCES rooms(id),
-		FOREIGN KEY (user_id) REFERENCES users(id),
-		UNIQUE(room_id, user_id)
-	);
-
-	CREATE TABLE IF NOT EXISTS blindtest_config (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		room_id INTEGER UNIQUE NOT NULL,
-		playlist TEXT NOT NULL,
-		response_time INTEGER DEFAULT 37,
-		nbr_rounds INTEGER NOT NULL,
-		FOREIGN KEY (room_id) REFERENCES rooms(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS petitbac_config (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		room_id INTEGER UNIQUE NOT NULL,
-		response_time INTEGER NOT NULL,
-		nbr_rounds INTEGER NOT NULL,
-		FOREIGN KEY (room_id) REFERENCES rooms(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS petitbac_categories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		room_id INTEGER NOT NULL,
-		category_name TEXT NOT NULL,
-		FOREIGN KEY (room_id) REFERENCES rooms(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS scores (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		room_id INTEGER NOT NULL,
-		user_id INTEGER NOT NULL,
-		game_type TEXT NOT NULL,
-		score INTEGER DEFAULT 0,
-		round_number INTEGER,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (room_id) REFERENCES rooms(id),
-		FOREIGN KEY (user_id) REFERENCES users(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		session_token TEXT UNIQUE NOT NULL,
-		expires_at DATETIME NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id)
-	);
-	`
-
-	_, err := DB.Exec(schema)
-	return err
+// Options appliquees par le pilote a chaque nouvelle connexion du pool.
+// _txlock=immediate prend le verrou d'ecriture des le BEGIN : une transaction qui lit
+// puis ecrit attend son tour (busy_timeout) au lieu d'echouer en "database is locked".
+func dsn(dbPath string) string {
+	params := url.Values{}
+	params.Set("_foreign_keys", "on")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_synchronous", "NORMAL")
+	params.Set("_txlock", "immediate")
+
+	return "file:" + dbPath + "?" + params.Encode()
 }
 
-func CloseDB() {
-	if DB != nil {
-		DB.Close()
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(postgresDriver); ok {
+		return Postgres
+	}
+	return SQLite
+}
+
+func CloseDB(db *sql.DB) {
+	if db != nil {
+		db.Close()
 		log.Println("Connexion a la base de donnees fermee")
 	}
 }
+
+// Indique si err vient d'une contrainte UNIQUE (pseudo ou email deja pris...),
+// avec SQLite comme avec PostgreSQL
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
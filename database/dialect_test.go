@@ -0,0 +1,237 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// URL d'une base PostgreSQL jetable ; sans elle, seul SQLite est teste
+const postgresTestEnv = "GROUPIE_TEST_POSTGRES_URL"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id FROM users", "SELECT id FROM users"},
+		{"SELECT id FROM users WHERE pseudo = ? AND email = ?", "SELECT id FROM users WHERE pseudo = $1 AND email = $2"},
+		{"UPDATE users SET ban_reason = 'pourquoi ?' WHERE id = ?", "UPDATE users SET ban_reason = 'pourquoi ?' WHERE id = $1"},
+		{"SELECT 'l''ami ?', ?", "SELECT 'l''ami ?', $1"},
+		{"SELECT id -- un ? ici\nFROM users WHERE id = ?", "SELECT id -- un ? ici\nFROM users WHERE id = $1"},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, attendu %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestConvertBools(t *testing.T) {
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: true},
+		{Ordinal: 2, Value: false},
+		{Ordinal: 3, Value: "true"},
+		{Ordinal: 4, Value: int64(7)},
+	}
+	want := []driver.Value{int64(1), int64(0), "true", int64(7)}
+
+	for i, arg := range convertBools(args) {
+		if arg.Value != want[i] {
+			t.Errorf("argument %d = %#v, attendu %#v", arg.Ordinal, arg.Value, want[i])
+		}
+	}
+}
+
+func TestNeedsReturningID(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"INSERT INTO users (pseudo) VALUES (?)", true},
+		{"  insert into rooms(code) values (?)", true},
+		{"INSERT INTO users (pseudo) VALUES (?) RETURNING id", false},
+		{"INSERT INTO ratings (user_id, game_type) VALUES (?, ?)", false},
+		{"INSERT INTO schema_migrations(version) VALUES (?)", false},
+		{"UPDATE users SET pseudo = ? WHERE id = ?", false},
+		{"SELECT id FROM users", false},
+	}
+	for _, tt := range tests {
+		if got := needsReturningID(tt.query); got != tt.want {
+			t.Errorf("needsReturningID(%q) = %v, attendu %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// Les memes requetes, ecrites pour SQLite, passent sur les deux dialectes
+func TestDialects(t *testing.T) {
+	dialects := []struct {
+		dialect Dialect
+		open    func(t *testing.T) *sql.DB
+	}{
+		{SQLite, func(t *testing.T) *sql.DB {
+			db, err := InitDB(string(SQLite), filepath.Join(t.TempDir(), "dialect.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		}},
+		{Postgres, openTestPostgres},
+	}
+
+	for _, d := range dialects {
+		t.Run(string(d.dialect), func(t *testing.T) {
+			db := d.open(t)
+			defer db.Close()
+
+			if got := DialectOf(db); got != d.dialect {
+				t.Fatalf("DialectOf = %q, attendu %q", got, d.dialect)
+			}
+			testDialect(t, db)
+		})
+	}
+}
+
+func testDialect(t *testing.T, db *sql.DB) {
+	insertUser := func(pseudo string, verified bool) (int64, error) {
+		result, err := db.Exec(
+			"INSERT INTO users (pseudo, pseudo_key, email, password_hash, email_verified) VALUES (?, ?, ?, '', ?)",
+			pseudo, strings.ToLower(pseudo), strings.ToLower(pseudo)+"@example.com", verified,
+		)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := result.RowsAffected(); err != nil || n != 1 {
+			t.Errorf("RowsAffected = %d, %v", n, err)
+		}
+		return result.LastInsertId()
+	}
+
+	// RETURNING id ajoute automatiquement : LastInsertId comme avec SQLite
+	aliceID, err := insertUser("Alice", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := insertUser("Bob", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliceID <= 0 || bobID <= aliceID {
+		t.Fatalf("ids %d puis %d", aliceID, bobID)
+	}
+
+	if _, err := insertUser("Alice", false); !IsUniqueViolation(err) {
+		t.Errorf("doublon: %v, attendu une violation d'unicite", err)
+	}
+
+	// Booleen en parametre et relu depuis une colonne INTEGER
+	var verified bool
+	if err := db.QueryRow("SELECT email_verified FROM users WHERE id = ?", aliceID).Scan(&verified); err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("email_verified relu a false")
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email_verified = ?", false).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d comptes non verifies, attendu 1", count)
+	}
+
+	// Un "?" dans une chaine n'est pas un parametre
+	if _, err := db.Exec("UPDATE users SET ban_reason = 'pourquoi ?' WHERE id = ?", bobID); err != nil {
+		t.Fatal(err)
+	}
+	var reason string
+	if err := db.QueryRow("SELECT ban_reason FROM users WHERE id = ?", bobID).Scan(&reason); err != nil {
+		t.Fatal(err)
+	}
+	if reason != "pourquoi ?" {
+		t.Errorf("ban_reason = %q", reason)
+	}
+
+	// Table sans colonne id : l'INSERT ne doit pas recevoir de RETURNING id
+	result, err := db.Exec("INSERT INTO ratings (user_id, game_type, rating) VALUES (?, ?, ?)", aliceID, "blindtest", 1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		t.Errorf("ratings: RowsAffected = %d, %v", n, err)
+	}
+
+	// Un RETURNING explicite n'est pas double
+	var roomID int64
+	if err := db.QueryRow(
+		"INSERT INTO rooms (code, game_type, host_id) VALUES (?, ?, ?) RETURNING id", "ABCD", "blindtest", aliceID,
+	).Scan(&roomID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Meme comportement dans une transaction
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	result, err = tx.Exec("INSERT INTO rooms (code, game_type, host_id) VALUES (?, ?, ?)", "EFGH", "petitbac", bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := result.LastInsertId(); id <= roomID {
+		t.Errorf("LastInsertId dans la transaction = %d, attendu > %d", id, roomID)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Chaque execution travaille dans son propre schema, supprime a la fin du test
+func openTestPostgres(t *testing.T) *sql.DB {
+	dataSource := os.Getenv(postgresTestEnv)
+	if dataSource == "" {
+		t.Skipf("%s non defini", postgresTestEnv)
+	}
+	if strings.HasPrefix(dataSource, "postgres://") || strings.HasPrefix(dataSource, "postgresql://") {
+		var err error
+		if dataSource, err = pq.ParseURL(dataSource); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin, err := OpenDB(string(Postgres), dataSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	schema := fmt.Sprintf("groupie_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cleanup, err := OpenDB(string(Postgres), dataSource)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer cleanup.Close()
+		if _, err := cleanup.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	db, err := InitDB(string(Postgres), dataSource+" search_path="+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Version du format JSON, a augmenter si les champs changent de sens
+const exportFormat = 1
+
+type Export struct {
+	Format         int              `json:"format"`
+	ExportedAt     time.Time        `json:"exported_at"`
+	PasswordHashes bool             `json:"password_hashes"`
+	Users          []ExportedUser   `json:"users"`
+	Rooms          []ExportedRoom   `json:"rooms"`
+	RoomPlayers    []ExportedPlayer `json:"room_players"`
+	Scores         []ExportedScore  `json:"scores"`
+	Playlists      []ExportedConfig `json:"playlists"`
+}
+
+type ExportedUser struct {
+	ID            int        `json:"id"`
+	Pseudo        string     `json:"pseudo"`
+	PseudoKey     *string    `json:"pseudo_key,omitempty"`
+	Email         string     `json:"email"`
+	PasswordHash  string     `json:"password_hash,omitempty"`
+	EmailVerified bool       `json:"email_verified"`
+	IsGuest       bool       `json:"is_guest"`
+	Role          string     `json:"role"`
+	BannedAt      *time.Time `json:"banned_at,omitempty"`
+	BanReason     *string    `json:"ban_reason,omitempty"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ExportedRoom struct {
+	ID         int       `json:"id"`
+	Code       string    `json:"code"`
+	GameType   string    `json:"game_type"`
+	HostID     int       `json:"host_id"`
+	MaxPlayers int       `json:"max_players"`
+	IsPublic   bool      `json:"is_public"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExportedPlayer struct {
+	RoomID   int       `json:"room_id"`
+	UserID   int       `json:"user_id"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type ExportedScore struct {
+	RoomID      int       `json:"room_id"`
+	UserID      int       `json:"user_id"`
+	GameType    string    `json:"game_type"`
+	Score       int       `json:"score"`
+	RoundNumber *int      `json:"round_number,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Configuration blind test d'une salle : playlist choisie et reglages
+type ExportedConfig struct {
+	RoomID       int    `json:"room_id"`
+	Playlist     string `json:"playlist"`
+	ResponseTime int    `json:"response_time"`
+	NbrRounds    int    `json:"nbr_rounds"`
+}
+
+var ErrImportNotEmpty = errors.New("la base de destination contient deja des utilisateurs")
+
+// Ecrit les donnees de jeu en JSON. Sans withPasswordHashes les comptes importes
+// devront passer par "Mot de passe oublie".
+func ExportJSON(db *sql.DB, w io.Writer, withPasswordHashes bool) error {
+	export := Export{
+		Format:         exportFormat,
+		ExportedAt:     time.Now().UTC(),
+		PasswordHashes: withPasswordHashes,
+	}
+
+	rows, err := db.Query(`
+		SELECT id, pseudo, pseudo_key, email, password_hash, email_verified, is_guest, role,
+			banned_at, ban_reason, deleted_at, created_at
+		FROM users ORDER BY id
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var u ExportedUser
+		err := rows.Scan(&u.ID, &u.Pseudo, &u.PseudoKey, &u.Email, &u.PasswordHash, &u.EmailVerified, &u.IsGuest, &u.Role,
+			&u.BannedAt, &u.BanReason, &u.DeletedAt, &u.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if !withPasswordHashes {
+			u.PasswordHash = ""
+		}
+		export.Users = append(export.Users, u)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT id, code, game_type, host_id, max_players, is_public, status, created_at FROM rooms ORDER BY id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var r ExportedRoom
+		if err := rows.Scan(&r.ID, &r.Code, &r.GameType, &r.HostID, &r.MaxPlayers, &r.IsPublic, &r.Status, &r.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		export.Rooms = append(export.Rooms, r)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT room_id, user_id, joined_at FROM room_players ORDER BY id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var p ExportedPlayer
+		if err := rows.Scan(&p.RoomID, &p.UserID, &p.JoinedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		export.RoomPlayers = append(export.RoomPlayers, p)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT room_id, user_id, game_type, score, round_number, created_at FROM scores ORDER BY id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var s ExportedScore
+		if err := rows.Scan(&s.RoomID, &s.UserID, &s.GameType, &s.Score, &s.RoundNumber, &s.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		export.Scores = append(export.Scores, s)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT room_id, playlist, response_time, nbr_rounds FROM blindtest_config ORDER BY id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c ExportedConfig
+		if err := rows.Scan(&c.RoomID, &c.Playlist, &c.ResponseTime, &c.NbrRounds); err != nil {
+			rows.Close()
+			return err
+		}
+		export.Playlists = append(export.Playlists, c)
+	}
+	rows.Close()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+// Recharge un export dans une base migree et sans utilisateurs. Les identifiants
+// des comptes et des salles sont conserves pour que les liens restent valables.
+func ImportJSON(db *sql.DB, r io.Reader) (*Export, error) {
+	var export Export
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("fichier d'export invalide: %w", err)
+	}
+	if export.Format != exportFormat {
+		return nil, fmt.Errorf("format d'export %d non pris en charge (attendu %d)", export.Format, exportFormat)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var users int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		return nil, err
+	}
+	if users > 0 {
+		return nil, ErrImportNotEmpty
+	}
+
+	for _, u := range export.Users {
+		_, err := tx.Exec(`
+			INSERT INTO users (id, pseudo, pseudo_key, email, password_hash, email_verified, is_guest, role,
+				banned_at, ban_reason, deleted_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, u.ID, u.Pseudo, u.PseudoKey, u.Email, u.PasswordHash, u.EmailVerified, u.IsGuest, u.Role,
+			u.BannedAt, u.BanReason, u.DeletedAt, u.CreatedAt.UTC())
+		if err != nil {
+			return nil, fmt.Errorf("utilisateur %d (%s): %w", u.ID, u.Pseudo, err)
+		}
+	}
+
+	for _, room := range export.Rooms {
+		_, err := tx.Exec(`
+			INSERT INTO rooms (id, code, game_type, host_id, max_players, is_public, status, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, room.ID, room.Code, room.GameType, room.HostID, room.MaxPlayers, room.IsPublic, room.Status, room.CreatedAt.UTC())
+		if err != nil {
+			return nil, fmt.Errorf("salle %s: %w", room.Code, err)
+		}
+	}
+
+	for _, p := range export.RoomPlayers {
+		_, err := tx.Exec("INSERT INTO room_players (room_id, user_id, joined_at) VALUES (?, ?, ?)", p.RoomID, p.UserID, p.JoinedAt.UTC())
+		if err != nil {
+			return nil, fmt.Errorf("joueur %d de la salle %d: %w", p.UserID, p.RoomID, err)
+		}
+	}
+
+	for _, s := range export.Scores {
+		_, err := tx.Exec(`
+			INSERT INTO scores (room_id, user_id, game_type, score, round_number, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, s.RoomID, s.UserID, s.GameType, s.Score, s.RoundNumber, s.CreatedAt.UTC())
+		if err != nil {
+			return nil, fmt.Errorf("score de %d dans la salle %d: %w", s.UserID, s.RoomID, err)
+		}
+	}
+
+	for _, c := range export.Playlists {
+		_, err := tx.Exec(`
+			INSERT INTO blindtest_config (room_id, playlist, response_time, nbr_rounds)
+			VALUES (?, ?, ?, ?)
+		`, c.RoomID, c.Playlist, c.ResponseTime, c.NbrRounds)
+		if err != nil {
+			return nil, fmt.Errorf("playlist de la salle %d: %w", c.RoomID, err)
+		}
+	}
+
+	// Les id inseres a la main ne font pas avancer les compteurs IDENTITY de PostgreSQL
+	if DialectOf(db) == Postgres {
+		for _, table := range []string{"users", "rooms"} {
+			_, err := tx.Exec("SELECT setval(pg_get_serial_sequence('" + table + "', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM " + table)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// Appele avant la migration 1 : une table users deja presente signifie que la base
+// a ete creee avant les migrations, parfois sans les colonnes recentes.
+func isLegacyDatabase(tx *sql.Tx) (bool, error) {
+	var exists bool
+	err := tx.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&exists)
+	return exists, err
+}
+
+// Met une ancienne base au niveau de la migration 1 : ajoute les colonnes
+// apparues avant les migrations. Les tables manquantes sont creees par la migration 1.
+// Ne plus modifier : les nouveaux changements de schema passent par database/migrations.
+func upgradeLegacySchema(tx *sql.Tx) error {
+	columns := []struct {
+		Table      string
+		Column     string
+		Definition string
+		// Requete executee une seule fois, quand la colonne vient d'etre ajoutee
+		Backfill string
+	}{
+		{"sessions", "last_seen_at", "DATETIME", ""},
+		{"sessions", "user_agent", "TEXT", ""},
+		{"sessions", "ip_address", "TEXT", ""},
+		{"sessions", "remember_me", "INTEGER DEFAULT 0", ""},
+		// Les comptes crees avant la verification des emails restent utilisables
+		{"users", "email_verified", "INTEGER NOT NULL DEFAULT 0", "UPDATE users SET email_verified = 1"},
+		{"users", "pending_email", "TEXT", ""},
+		{"users", "deleted_at", "DATETIME", ""},
+		{"users", "is_guest", "INTEGER NOT NULL DEFAULT 0", ""},
+		{"users", "role", "TEXT NOT NULL DEFAULT 'user'", ""},
+		{"users", "banned_at", "DATETIME", ""},
+		{"users", "ban_reason", "TEXT", ""},
+		// Rempli au demarrage par auth.BackfillPseudoKeys
+		{"users", "pseudo_key", "TEXT", ""},
+	}
+
+	for _, c := range columns {
+		added, err := addColumnIfMissing(tx, c.Table, c.Column, c.Definition)
+		if err != nil {
+			return err
+		}
+		if added && c.Backfill != "" {
+			if _, err := tx.Exec(c.Backfill); err != nil {
+				return err
+			}
+		}
+	}
+
+	return invalidatePlaintextSessions(tx)
+}
+
+// Avant la version 1 du schema, les jetons de session etaient stockes en clair.
+// Ils ne peuvent pas etre distingues des empreintes SHA-256 : on les supprime tous.
+func invalidatePlaintextSessions(tx *sql.Tx) error {
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version >= 1 {
+		return nil
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'sessions'").Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		result, err := tx.Exec("DELETE FROM sessions")
+		if err != nil {
+			return err
+		}
+		if deleted, _ := result.RowsAffected(); deleted > 0 {
+			log.Printf("%d sessions en clair invalidees", deleted)
+		}
+	}
+
+	_, err := tx.Exec("PRAGMA user_version = 1")
+	return err
+}
+
+// Une table absente est ignoree : la migration 1 la creera avec toutes ses colonnes
+func addColumnIfMissing(tx *sql.Tx, table string, column string, definition string) (bool, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		found = true
+		if name == column {
+			return false, nil
+		}
+	}
+	rows.Close()
+
+	if !found {
+		return false, nil
+	}
+
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,383 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fichiers NNNN_nom.up.sql et NNNN_nom.down.sql, appliques dans l'ordre des numeros.
+// Un dossier par dialecte : chaque migration existe en version sqlite et postgres
+// avec le meme numero.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Appliquee en base mais absente de ce binaire (base plus recente que le code)
+	Unknown bool
+}
+
+var ErrNoDownMigration = errors.New("migration sans fichier down")
+
+func LoadMigrations(dialect Dialect) ([]Migration, error) {
+	dir := "migrations/" + string(dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := splitMigrationFile(file)
+		if !ok {
+			return nil, fmt.Errorf("nom de migration invalide: %s", file)
+		}
+
+		versionStr, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("numero de migration invalide: %s", file)
+		}
+
+		content, err := migrationFiles.ReadFile(dir + "/" + file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d en double: %s et %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) sans fichier up", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func splitMigrationFile(file string) (string, string, bool) {
+	if base, ok := strings.CutSuffix(file, ".up.sql"); ok {
+		return base, "up", true
+	}
+	if base, ok := strings.CutSuffix(file, ".down.sql"); ok {
+		return base, "down", true
+	}
+	return "", "", false
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	timestampType := "DATETIME"
+	if DialectOf(db) == Postgres {
+		timestampType = "TIMESTAMP"
+	}
+
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at ` + timestampType + ` DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	return err
+}
+
+func appliedMigrations(db *sql.DB) (map[int]MigrationStatus, error) {
+	rows, err := db.Query("SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		var s MigrationStatus
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, err
+		}
+		s.Applied = true
+		applied[s.Version] = s
+	}
+	return applied, rows.Err()
+}
+
+// Applique toutes les migrations en attente
+func Migrate(db *sql.DB) error {
+	return MigrateTo(db, -1)
+}
+
+// Monte ou descend jusqu'a la version demandee (-1 pour la derniere, 0 pour une base vide)
+func MigrateTo(db *sql.DB, target int) error {
+	migrations, err := LoadMigrations(DialectOf(db))
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	if target < 0 && len(migrations) > 0 {
+		target = migrations[len(migrations)-1].Version
+	}
+
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for version, s := range applied {
+		if version > target && !known[version] {
+			return fmt.Errorf("migration %d (%s) inconnue de cette version du serveur", version, s.Name)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		log.Printf("Migration %04d_%s appliquee", m.Version, m.Name)
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := revertMigration(db, m); err != nil {
+			return fmt.Errorf("annulation migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		log.Printf("Migration %04d_%s annulee", m.Version, m.Name)
+	}
+
+	return nil
+}
+
+// Annule les n dernieres migrations appliquees
+func Rollback(db *sql.DB, steps int) error {
+	statuses, err := Status(db)
+	if err != nil {
+		return err
+	}
+
+	var applied []MigrationStatus
+	for _, s := range statuses {
+		if s.Applied {
+			applied = append(applied, s)
+		}
+	}
+	if steps > len(applied) {
+		steps = len(applied)
+	}
+	if steps <= 0 {
+		return nil
+	}
+
+	last := applied[len(applied)-steps:]
+	for _, s := range last {
+		if s.Unknown {
+			return fmt.Errorf("migration %d (%s) inconnue de cette version du serveur", s.Version, s.Name)
+		}
+	}
+
+	target := 0
+	if len(applied) > steps {
+		target = applied[len(applied)-steps-1].Version
+	}
+	return MigrateTo(db, target)
+}
+
+// Etat de chaque migration connue, plus celles appliquees en base mais absentes du code
+func Status(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations(DialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s, ok := applied[m.Version]
+		if !ok {
+			s = MigrationStatus{Version: m.Version, Name: m.Name}
+		}
+		statuses = append(statuses, s)
+		delete(applied, m.Version)
+	}
+	for _, s := range applied {
+		s.Unknown = true
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Le SQL de la migration et son enregistrement sont faits dans la meme transaction :
+// en cas d'erreur la base reste dans l'etat precedent
+func applyMigration(db *sql.DB, m Migration) error {
+	return inMigrationTx(db, func(tx *sql.Tx) error {
+		if m.Version == 1 && DialectOf(db) == SQLite {
+			legacy, err := isLegacyDatabase(tx)
+			if err != nil {
+				return err
+			}
+			if legacy {
+				log.Println("Base existante sans migrations : mise a niveau du schema")
+				if err := upgradeLegacySchema(tx); err != nil {
+					return err
+				}
+			}
+		}
+
+		if _, err := tx.Exec(m.Up); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC())
+		return err
+	})
+}
+
+func revertMigration(db *sql.DB, m Migration) error {
+	if m.Down == "" {
+		return ErrNoDownMigration
+	}
+
+	return inMigrationTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		return err
+	})
+}
+
+// Recreer une table (seule facon de changer une contrainte en SQLite) declencherait
+// les ON DELETE des tables filles : les cles etrangeres sont desactivees sur la
+// connexion le temps de la migration, puis verifiees avant le commit.
+// PRAGMA foreign_keys est sans effet dans une transaction, d'ou la connexion dediee.
+func inMigrationTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	// PostgreSQL modifie les contraintes sur place (ALTER TABLE) : transaction ordinaire
+	if DialectOf(db) == Postgres {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Les anciennes bases peuvent contenir des lignes orphelines : seules celles
+	// introduites par la migration la font echouer
+	before, err := countForeignKeyViolations(tx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	after, err := countForeignKeyViolations(tx)
+	if err != nil {
+		return err
+	}
+	if after > before {
+		return fmt.Errorf("%d references de cles etrangeres invalides apres la migration", after-before)
+	}
+
+	return tx.Commit()
+}
+
+func countForeignKeyViolations(tx *sql.Tx) (int, error) {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
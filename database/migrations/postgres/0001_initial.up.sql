@@ -0,0 +1,197 @@
+-- Schema de reference pour PostgreSQL, identique a celui de SQLite : booleens en INTEGER 0/1,
+-- dates en TIMESTAMP UTC sans fuseau (comme CURRENT_TIMESTAMP en SQLite).
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	pseudo TEXT UNIQUE NOT NULL,
+	pseudo_key TEXT,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	email_verified INTEGER NOT NULL DEFAULT 0,
+	pending_email TEXT,
+	deleted_at TIMESTAMP,
+	is_guest INTEGER NOT NULL DEFAULT 0,
+	role TEXT NOT NULL DEFAULT 'user',
+	banned_at TIMESTAMP,
+	ban_reason TEXT,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	code TEXT UNIQUE NOT NULL,
+	game_type TEXT NOT NULL,
+	host_id INTEGER NOT NULL,
+	max_players INTEGER DEFAULT 10,
+	status TEXT DEFAULT 'waiting',
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (host_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS room_players (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	room_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	joined_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (room_id) REFERENCES rooms(id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	UNIQUE(room_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS blindtest_config (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	room_id INTEGER UNIQUE NOT NULL,
+	playlist TEXT NOT NULL,
+	response_time INTEGER DEFAULT 37,
+	nbr_rounds INTEGER NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS petitbac_config (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	room_id INTEGER UNIQUE NOT NULL,
+	response_time INTEGER NOT NULL,
+	nbr_rounds INTEGER NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS petitbac_categories (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	room_id INTEGER NOT NULL,
+	category_name TEXT NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS scores (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	room_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	score INTEGER DEFAULT 0,
+	round_number INTEGER,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (room_id) REFERENCES rooms(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS blindtest_rounds (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	room_id INTEGER NOT NULL,
+	round_number INTEGER NOT NULL,
+	deezer_track_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	artist TEXT NOT NULL,
+	album_cover TEXT,
+	started_at TIMESTAMP NOT NULL,
+	ended_at TIMESTAMP,
+	FOREIGN KEY (room_id) REFERENCES rooms(id),
+	UNIQUE(room_id, round_number)
+);
+
+CREATE TABLE IF NOT EXISTS blindtest_guesses (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	round_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	raw_text TEXT NOT NULL,
+	matched_field TEXT,
+	elapsed_ms INTEGER NOT NULL,
+	points INTEGER DEFAULT 0,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (round_id) REFERENCES blindtest_rounds(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS ratings (
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	rating INTEGER NOT NULL DEFAULT 1500,
+	games_played INTEGER DEFAULT 0,
+	updated_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	PRIMARY KEY (user_id, game_type),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS rating_history (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	room_id INTEGER NOT NULL,
+	rating_before INTEGER NOT NULL,
+	rating_after INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_achievements (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	achievement_code TEXT NOT NULL,
+	unlocked_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	UNIQUE(user_id, achievement_code)
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	identifier TEXT NOT NULL,
+	user_id INTEGER,
+	ip_address TEXT NOT NULL,
+	success INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_identifier ON login_attempts(identifier, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user ON login_attempts(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, created_at);
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	purpose TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	UNIQUE(issuer, subject)
+);
+
+CREATE TABLE IF NOT EXISTS reports (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	reporter_id INTEGER NOT NULL,
+	reported_user_id INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	resolved_at TIMESTAMP,
+	resolved_by INTEGER,
+	FOREIGN KEY (reporter_id) REFERENCES users(id),
+	FOREIGN KEY (reported_user_id) REFERENCES users(id),
+	FOREIGN KEY (resolved_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	session_token TEXT UNIQUE NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	last_seen_at TIMESTAMP,
+	user_agent TEXT,
+	ip_address TEXT,
+	remember_me INTEGER DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_pseudo_key ON users(pseudo_key);
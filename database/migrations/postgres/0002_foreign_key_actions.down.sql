@@ -0,0 +1,77 @@
+-- Retire les regles ON DELETE
+
+ALTER TABLE rooms
+	DROP CONSTRAINT rooms_host_id_fkey,
+	ADD CONSTRAINT rooms_host_id_fkey FOREIGN KEY (host_id) REFERENCES users(id);
+
+ALTER TABLE room_players
+	DROP CONSTRAINT room_players_room_id_fkey,
+	ADD CONSTRAINT room_players_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id),
+	DROP CONSTRAINT room_players_user_id_fkey,
+	ADD CONSTRAINT room_players_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE blindtest_config
+	DROP CONSTRAINT blindtest_config_room_id_fkey,
+	ADD CONSTRAINT blindtest_config_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id);
+
+ALTER TABLE petitbac_config
+	DROP CONSTRAINT petitbac_config_room_id_fkey,
+	ADD CONSTRAINT petitbac_config_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id);
+
+ALTER TABLE petitbac_categories
+	DROP CONSTRAINT petitbac_categories_room_id_fkey,
+	ADD CONSTRAINT petitbac_categories_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id);
+
+ALTER TABLE scores
+	DROP CONSTRAINT scores_room_id_fkey,
+	ADD CONSTRAINT scores_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id),
+	DROP CONSTRAINT scores_user_id_fkey,
+	ADD CONSTRAINT scores_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE blindtest_rounds
+	DROP CONSTRAINT blindtest_rounds_room_id_fkey,
+	ADD CONSTRAINT blindtest_rounds_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id);
+
+ALTER TABLE blindtest_guesses
+	DROP CONSTRAINT blindtest_guesses_round_id_fkey,
+	ADD CONSTRAINT blindtest_guesses_round_id_fkey FOREIGN KEY (round_id) REFERENCES blindtest_rounds(id),
+	DROP CONSTRAINT blindtest_guesses_user_id_fkey,
+	ADD CONSTRAINT blindtest_guesses_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE ratings
+	DROP CONSTRAINT ratings_user_id_fkey,
+	ADD CONSTRAINT ratings_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE rating_history
+	DROP CONSTRAINT rating_history_user_id_fkey,
+	ADD CONSTRAINT rating_history_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id),
+	DROP CONSTRAINT rating_history_room_id_fkey,
+	ADD CONSTRAINT rating_history_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id);
+
+ALTER TABLE user_achievements
+	DROP CONSTRAINT user_achievements_user_id_fkey,
+	ADD CONSTRAINT user_achievements_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE login_attempts
+	DROP CONSTRAINT login_attempts_user_id_fkey,
+	ADD CONSTRAINT login_attempts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE email_tokens
+	DROP CONSTRAINT email_tokens_user_id_fkey,
+	ADD CONSTRAINT email_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE user_identities
+	DROP CONSTRAINT user_identities_user_id_fkey,
+	ADD CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE reports
+	DROP CONSTRAINT reports_reporter_id_fkey,
+	ADD CONSTRAINT reports_reporter_id_fkey FOREIGN KEY (reporter_id) REFERENCES users(id),
+	DROP CONSTRAINT reports_reported_user_id_fkey,
+	ADD CONSTRAINT reports_reported_user_id_fkey FOREIGN KEY (reported_user_id) REFERENCES users(id),
+	DROP CONSTRAINT reports_resolved_by_fkey,
+	ADD CONSTRAINT reports_resolved_by_fkey FOREIGN KEY (resolved_by) REFERENCES users(id);
+
+ALTER TABLE sessions
+	DROP CONSTRAINT sessions_user_id_fkey,
+	ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
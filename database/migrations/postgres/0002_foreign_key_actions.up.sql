@@ -0,0 +1,77 @@
+-- Ajoute les regles ON DELETE aux cles etrangeres (noms par defaut table_colonne_fkey)
+
+ALTER TABLE rooms
+	DROP CONSTRAINT rooms_host_id_fkey,
+	ADD CONSTRAINT rooms_host_id_fkey FOREIGN KEY (host_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE room_players
+	DROP CONSTRAINT room_players_room_id_fkey,
+	ADD CONSTRAINT room_players_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+	DROP CONSTRAINT room_players_user_id_fkey,
+	ADD CONSTRAINT room_players_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE blindtest_config
+	DROP CONSTRAINT blindtest_config_room_id_fkey,
+	ADD CONSTRAINT blindtest_config_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+
+ALTER TABLE petitbac_config
+	DROP CONSTRAINT petitbac_config_room_id_fkey,
+	ADD CONSTRAINT petitbac_config_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+
+ALTER TABLE petitbac_categories
+	DROP CONSTRAINT petitbac_categories_room_id_fkey,
+	ADD CONSTRAINT petitbac_categories_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+
+ALTER TABLE scores
+	DROP CONSTRAINT scores_room_id_fkey,
+	ADD CONSTRAINT scores_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+	DROP CONSTRAINT scores_user_id_fkey,
+	ADD CONSTRAINT scores_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE blindtest_rounds
+	DROP CONSTRAINT blindtest_rounds_room_id_fkey,
+	ADD CONSTRAINT blindtest_rounds_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+
+ALTER TABLE blindtest_guesses
+	DROP CONSTRAINT blindtest_guesses_round_id_fkey,
+	ADD CONSTRAINT blindtest_guesses_round_id_fkey FOREIGN KEY (round_id) REFERENCES blindtest_rounds(id) ON DELETE CASCADE,
+	DROP CONSTRAINT blindtest_guesses_user_id_fkey,
+	ADD CONSTRAINT blindtest_guesses_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE ratings
+	DROP CONSTRAINT ratings_user_id_fkey,
+	ADD CONSTRAINT ratings_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE rating_history
+	DROP CONSTRAINT rating_history_user_id_fkey,
+	ADD CONSTRAINT rating_history_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	DROP CONSTRAINT rating_history_room_id_fkey,
+	ADD CONSTRAINT rating_history_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
+
+ALTER TABLE user_achievements
+	DROP CONSTRAINT user_achievements_user_id_fkey,
+	ADD CONSTRAINT user_achievements_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE login_attempts
+	DROP CONSTRAINT login_attempts_user_id_fkey,
+	ADD CONSTRAINT login_attempts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE email_tokens
+	DROP CONSTRAINT email_tokens_user_id_fkey,
+	ADD CONSTRAINT email_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE user_identities
+	DROP CONSTRAINT user_identities_user_id_fkey,
+	ADD CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE reports
+	DROP CONSTRAINT reports_reporter_id_fkey,
+	ADD CONSTRAINT reports_reporter_id_fkey FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+	DROP CONSTRAINT reports_reported_user_id_fkey,
+	ADD CONSTRAINT reports_reported_user_id_fkey FOREIGN KEY (reported_user_id) REFERENCES users(id) ON DELETE CASCADE,
+	DROP CONSTRAINT reports_resolved_by_fkey,
+	ADD CONSTRAINT reports_resolved_by_fkey FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE sessions
+	DROP CONSTRAINT sessions_user_id_fkey,
+	ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
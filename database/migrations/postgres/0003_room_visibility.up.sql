@@ -0,0 +1,4 @@
+-- Seules les salles publiques sont proposees aux autres joueurs. Les salles
+-- existantes restent privees : leur code n'avait ete partage qu'a la main.
+
+ALTER TABLE rooms ADD COLUMN is_public INTEGER NOT NULL DEFAULT 0;
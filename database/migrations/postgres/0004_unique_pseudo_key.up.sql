@@ -0,0 +1,11 @@
+-- Deux comptes ne peuvent plus partager un pseudo (a la casse et aux caracteres
+-- ressemblants pres). Les doublons herites gardent leur pseudo pour le plus
+-- ancien compte ; les autres perdent leur cle et sont renommes au demarrage par
+-- auth.BackfillPseudoKeys.
+
+UPDATE users SET pseudo_key = NULL
+WHERE pseudo_key IS NOT NULL
+	AND EXISTS (SELECT 1 FROM users older WHERE older.pseudo_key = users.pseudo_key AND older.id < users.id);
+
+DROP INDEX IF EXISTS idx_users_pseudo_key;
+CREATE UNIQUE INDEX idx_users_pseudo_key ON users(pseudo_key);
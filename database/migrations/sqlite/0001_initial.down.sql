@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS email_tokens;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS user_achievements;
+DROP TABLE IF EXISTS rating_history;
+DROP TABLE IF EXISTS ratings;
+DROP TABLE IF EXISTS blindtest_guesses;
+DROP TABLE IF EXISTS blindtest_rounds;
+DROP TABLE IF EXISTS scores;
+DROP TABLE IF EXISTS petitbac_categories;
+DROP TABLE IF EXISTS petitbac_config;
+DROP TABLE IF EXISTS blindtest_config;
+DROP TABLE IF EXISTS room_players;
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,197 @@
+-- Schema de reference. Les IF NOT EXISTS permettent d'adopter les bases creees avant
+-- l'introduction des migrations (voir upgradeLegacySchema).
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	pseudo TEXT UNIQUE NOT NULL,
+	pseudo_key TEXT,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	email_verified INTEGER NOT NULL DEFAULT 0,
+	pending_email TEXT,
+	deleted_at DATETIME,
+	is_guest INTEGER NOT NULL DEFAULT 0,
+	role TEXT NOT NULL DEFAULT 'user',
+	banned_at DATETIME,
+	ban_reason TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code TEXT UNIQUE NOT NULL,
+	game_type TEXT NOT NULL,
+	host_id INTEGER NOT NULL,
+	max_players INTEGER DEFAULT 10,
+	status TEXT DEFAULT 'waiting',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (host_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS room_players (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (room_id) REFERENCES rooms(id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	UNIQUE(room_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS blindtest_config (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER UNIQUE NOT NULL,
+	playlist TEXT NOT NULL,
+	response_time INTEGER DEFAULT 37,
+	nbr_rounds INTEGER NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS petitbac_config (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER UNIQUE NOT NULL,
+	response_time INTEGER NOT NULL,
+	nbr_rounds INTEGER NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS petitbac_categories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	category_name TEXT NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS scores (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	score INTEGER DEFAULT 0,
+	round_number INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (room_id) REFERENCES rooms(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS blindtest_rounds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	round_number INTEGER NOT NULL,
+	deezer_track_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	artist TEXT NOT NULL,
+	album_cover TEXT,
+	started_at DATETIME NOT NULL,
+	ended_at DATETIME,
+	FOREIGN KEY (room_id) REFERENCES rooms(id),
+	UNIQUE(room_id, round_number)
+);
+
+CREATE TABLE IF NOT EXISTS blindtest_guesses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	round_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	raw_text TEXT NOT NULL,
+	matched_field TEXT,
+	elapsed_ms INTEGER NOT NULL,
+	points INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (round_id) REFERENCES blindtest_rounds(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS ratings (
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	rating INTEGER NOT NULL DEFAULT 1500,
+	games_played INTEGER DEFAULT 0,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, game_type),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS rating_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	room_id INTEGER NOT NULL,
+	rating_before INTEGER NOT NULL,
+	rating_after INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_achievements (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	achievement_code TEXT NOT NULL,
+	unlocked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	UNIQUE(user_id, achievement_code)
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	identifier TEXT NOT NULL,
+	user_id INTEGER,
+	ip_address TEXT NOT NULL,
+	success INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_identifier ON login_attempts(identifier, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user ON login_attempts(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, created_at);
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	purpose TEXT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	UNIQUE(issuer, subject)
+);
+
+CREATE TABLE IF NOT EXISTS reports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	reporter_id INTEGER NOT NULL,
+	reported_user_id INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	resolved_at DATETIME,
+	resolved_by INTEGER,
+	FOREIGN KEY (reporter_id) REFERENCES users(id),
+	FOREIGN KEY (reported_user_id) REFERENCES users(id),
+	FOREIGN KEY (resolved_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	session_token TEXT UNIQUE NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_seen_at DATETIME,
+	user_agent TEXT,
+	ip_address TEXT,
+	remember_me INTEGER DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_pseudo_key ON users(pseudo_key);
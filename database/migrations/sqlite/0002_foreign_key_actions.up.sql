@@ -0,0 +1,250 @@
+-- SQLite ne permet pas de modifier une contrainte : chaque table est recreee avec ses
+-- regles ON DELETE. Les cles etrangeres sont desactivees pendant la migration (voir applyMigration).
+
+-- Lignes orphelines heritees de l'epoque ou les cles etrangeres n'etaient pas verifiees
+DELETE FROM rooms WHERE host_id NOT IN (SELECT id FROM users);
+DELETE FROM room_players WHERE room_id NOT IN (SELECT id FROM rooms);
+DELETE FROM room_players WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM blindtest_config WHERE room_id NOT IN (SELECT id FROM rooms);
+DELETE FROM petitbac_config WHERE room_id NOT IN (SELECT id FROM rooms);
+DELETE FROM petitbac_categories WHERE room_id NOT IN (SELECT id FROM rooms);
+DELETE FROM scores WHERE room_id NOT IN (SELECT id FROM rooms);
+DELETE FROM scores WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM blindtest_rounds WHERE room_id NOT IN (SELECT id FROM rooms);
+DELETE FROM blindtest_guesses WHERE round_id NOT IN (SELECT id FROM blindtest_rounds);
+DELETE FROM blindtest_guesses WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM ratings WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM rating_history WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM rating_history WHERE room_id NOT IN (SELECT id FROM rooms);
+DELETE FROM user_achievements WHERE user_id NOT IN (SELECT id FROM users);
+UPDATE login_attempts SET user_id = NULL WHERE user_id IS NOT NULL AND user_id NOT IN (SELECT id FROM users);
+DELETE FROM email_tokens WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM user_identities WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM reports WHERE reporter_id NOT IN (SELECT id FROM users);
+DELETE FROM reports WHERE reported_user_id NOT IN (SELECT id FROM users);
+UPDATE reports SET resolved_by = NULL WHERE resolved_by IS NOT NULL AND resolved_by NOT IN (SELECT id FROM users);
+DELETE FROM sessions WHERE user_id NOT IN (SELECT id FROM users);
+
+CREATE TABLE rooms_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code TEXT UNIQUE NOT NULL,
+	game_type TEXT NOT NULL,
+	host_id INTEGER NOT NULL,
+	max_players INTEGER DEFAULT 10,
+	status TEXT DEFAULT 'waiting',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (host_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO rooms_new (id, code, game_type, host_id, max_players, status, created_at) SELECT id, code, game_type, host_id, max_players, status, created_at FROM rooms;
+DROP TABLE rooms;
+ALTER TABLE rooms_new RENAME TO rooms;
+
+CREATE TABLE room_players_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE(room_id, user_id)
+);
+INSERT INTO room_players_new (id, room_id, user_id, joined_at) SELECT id, room_id, user_id, joined_at FROM room_players;
+DROP TABLE room_players;
+ALTER TABLE room_players_new RENAME TO room_players;
+
+CREATE TABLE blindtest_config_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER UNIQUE NOT NULL,
+	playlist TEXT NOT NULL,
+	response_time INTEGER DEFAULT 37,
+	nbr_rounds INTEGER NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE
+);
+INSERT INTO blindtest_config_new (id, room_id, playlist, response_time, nbr_rounds) SELECT id, room_id, playlist, response_time, nbr_rounds FROM blindtest_config;
+DROP TABLE blindtest_config;
+ALTER TABLE blindtest_config_new RENAME TO blindtest_config;
+
+CREATE TABLE petitbac_config_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER UNIQUE NOT NULL,
+	response_time INTEGER NOT NULL,
+	nbr_rounds INTEGER NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE
+);
+INSERT INTO petitbac_config_new (id, room_id, response_time, nbr_rounds) SELECT id, room_id, response_time, nbr_rounds FROM petitbac_config;
+DROP TABLE petitbac_config;
+ALTER TABLE petitbac_config_new RENAME TO petitbac_config;
+
+CREATE TABLE petitbac_categories_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	category_name TEXT NOT NULL,
+	FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE
+);
+INSERT INTO petitbac_categories_new (id, room_id, category_name) SELECT id, room_id, category_name FROM petitbac_categories;
+DROP TABLE petitbac_categories;
+ALTER TABLE petitbac_categories_new RENAME TO petitbac_categories;
+
+CREATE TABLE scores_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	score INTEGER DEFAULT 0,
+	round_number INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO scores_new (id, room_id, user_id, game_type, score, round_number, created_at) SELECT id, room_id, user_id, game_type, score, round_number, created_at FROM scores;
+DROP TABLE scores;
+ALTER TABLE scores_new RENAME TO scores;
+
+CREATE TABLE blindtest_rounds_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id INTEGER NOT NULL,
+	round_number INTEGER NOT NULL,
+	deezer_track_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	artist TEXT NOT NULL,
+	album_cover TEXT,
+	started_at DATETIME NOT NULL,
+	ended_at DATETIME,
+	FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+	UNIQUE(room_id, round_number)
+);
+INSERT INTO blindtest_rounds_new (id, room_id, round_number, deezer_track_id, title, artist, album_cover, started_at, ended_at) SELECT id, room_id, round_number, deezer_track_id, title, artist, album_cover, started_at, ended_at FROM blindtest_rounds;
+DROP TABLE blindtest_rounds;
+ALTER TABLE blindtest_rounds_new RENAME TO blindtest_rounds;
+
+CREATE TABLE blindtest_guesses_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	round_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	raw_text TEXT NOT NULL,
+	matched_field TEXT,
+	elapsed_ms INTEGER NOT NULL,
+	points INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (round_id) REFERENCES blindtest_rounds(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO blindtest_guesses_new (id, round_id, user_id, raw_text, matched_field, elapsed_ms, points, created_at) SELECT id, round_id, user_id, raw_text, matched_field, elapsed_ms, points, created_at FROM blindtest_guesses;
+DROP TABLE blindtest_guesses;
+ALTER TABLE blindtest_guesses_new RENAME TO blindtest_guesses;
+
+CREATE TABLE ratings_new (
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	rating INTEGER NOT NULL DEFAULT 1500,
+	games_played INTEGER DEFAULT 0,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, game_type),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO ratings_new (user_id, game_type, rating, games_played, updated_at) SELECT user_id, game_type, rating, games_played, updated_at FROM ratings;
+DROP TABLE ratings;
+ALTER TABLE ratings_new RENAME TO ratings;
+
+CREATE TABLE rating_history_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_type TEXT NOT NULL,
+	room_id INTEGER NOT NULL,
+	rating_before INTEGER NOT NULL,
+	rating_after INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE
+);
+INSERT INTO rating_history_new (id, user_id, game_type, room_id, rating_before, rating_after, created_at) SELECT id, user_id, game_type, room_id, rating_before, rating_after, created_at FROM rating_history;
+DROP TABLE rating_history;
+ALTER TABLE rating_history_new RENAME TO rating_history;
+
+CREATE TABLE user_achievements_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	achievement_code TEXT NOT NULL,
+	unlocked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE(user_id, achievement_code)
+);
+INSERT INTO user_achievements_new (id, user_id, achievement_code, unlocked_at) SELECT id, user_id, achievement_code, unlocked_at FROM user_achievements;
+DROP TABLE user_achievements;
+ALTER TABLE user_achievements_new RENAME TO user_achievements;
+
+CREATE TABLE login_attempts_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	identifier TEXT NOT NULL,
+	user_id INTEGER,
+	ip_address TEXT NOT NULL,
+	success INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+INSERT INTO login_attempts_new (id, identifier, user_id, ip_address, success, created_at) SELECT id, identifier, user_id, ip_address, success, created_at FROM login_attempts;
+DROP TABLE login_attempts;
+ALTER TABLE login_attempts_new RENAME TO login_attempts;
+CREATE INDEX idx_login_attempts_identifier ON login_attempts(identifier, created_at);
+CREATE INDEX idx_login_attempts_user ON login_attempts(user_id, created_at);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip_address, created_at);
+
+CREATE TABLE email_tokens_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	purpose TEXT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO email_tokens_new (id, user_id, token_hash, purpose, expires_at, used_at, created_at) SELECT id, user_id, token_hash, purpose, expires_at, used_at, created_at FROM email_tokens;
+DROP TABLE email_tokens;
+ALTER TABLE email_tokens_new RENAME TO email_tokens;
+
+CREATE TABLE user_identities_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE(issuer, subject)
+);
+INSERT INTO user_identities_new (id, user_id, issuer, subject, email, created_at) SELECT id, user_id, issuer, subject, email, created_at FROM user_identities;
+DROP TABLE user_identities;
+ALTER TABLE user_identities_new RENAME TO user_identities;
+
+CREATE TABLE reports_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	reporter_id INTEGER NOT NULL,
+	reported_user_id INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	resolved_at DATETIME,
+	resolved_by INTEGER,
+	FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (reported_user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+INSERT INTO reports_new (id, reporter_id, reported_user_id, reason, created_at, resolved_at, resolved_by) SELECT id, reporter_id, reported_user_id, reason, created_at, resolved_at, resolved_by FROM reports;
+DROP TABLE reports;
+ALTER TABLE reports_new RENAME TO reports;
+
+CREATE TABLE sessions_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	session_token TEXT UNIQUE NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_seen_at DATETIME,
+	user_agent TEXT,
+	ip_address TEXT,
+	remember_me INTEGER DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO sessions_new (id, user_id, session_token, expires_at, created_at, last_seen_at, user_agent, ip_address, remember_me) SELECT id, user_id, session_token, expires_at, created_at, last_seen_at, user_agent, ip_address, remember_me FROM sessions;
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
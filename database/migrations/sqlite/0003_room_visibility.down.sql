@@ -0,0 +1 @@
+ALTER TABLE rooms DROP COLUMN is_public;
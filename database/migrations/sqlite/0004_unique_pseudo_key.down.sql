@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_pseudo_key;
+CREATE INDEX idx_users_pseudo_key ON users(pseudo_key);
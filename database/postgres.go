@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Tout le code SQL du projet est ecrit pour SQLite : parametres "?", LastInsertId,
+// booleens Go stockes dans des colonnes INTEGER. Ce pilote enveloppe lib/pq et
+// traduit ces trois points pour PostgreSQL, sans toucher aux requetes des paquets.
+const postgresDriverName = "groupie-postgres"
+
+// Tables sans colonne id : pas de RETURNING id sur leurs INSERT
+var tablesWithoutID = map[string]bool{
+	"ratings":           true,
+	"schema_migrations": true,
+}
+
+func init() {
+	sql.Register(postgresDriverName, postgresDriver{})
+}
+
+type postgresDriver struct{}
+
+func (postgresDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := pq.Driver{}.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{conn: conn}, nil
+}
+
+type postgresConn struct {
+	conn driver.Conn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(rebind(query))
+}
+
+func (c *postgresConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *postgresConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *postgresConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *postgresConn) Ping(ctx context.Context) error {
+	return c.conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *postgresConn) ResetSession(ctx context.Context) error {
+	return c.conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *postgresConn) IsValid() bool {
+	return c.conn.(driver.Validator).IsValid()
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.conn.(driver.QueryerContext).QueryContext(ctx, rebind(query), convertBools(args))
+}
+
+// Les INSERT recoivent un RETURNING id pour que LastInsertId fonctionne comme avec SQLite
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query = rebind(query)
+	args = convertBools(args)
+
+	if !needsReturningID(query) {
+		return c.conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	}
+
+	rows, err := c.conn.(driver.QueryerContext).QueryContext(ctx, strings.TrimRight(strings.TrimSpace(query), ";")+" RETURNING id", args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := postgresResult{}
+	values := make([]driver.Value, 1)
+	for {
+		err := rows.Next(values)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.rowsAffected++
+		if id, ok := values[0].(int64); ok {
+			result.lastInsertID = id
+		}
+	}
+
+	return result, nil
+}
+
+type postgresResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r postgresResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r postgresResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// Remplace les "?" par $1, $2... en ignorant ceux des chaines et des commentaires
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	inString, inComment := false, false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case inComment:
+			if ch == '\n' {
+				inComment = false
+			}
+		case inString:
+			if ch == '\'' {
+				inString = false
+			}
+		case ch == '\'':
+			inString = true
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			inComment = true
+		case ch == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// Les colonnes booleennes du schema sont des INTEGER 0/1, comme en SQLite
+func convertBools(args []driver.NamedValue) []driver.NamedValue {
+	for i, arg := range args {
+		if v, ok := arg.Value.(bool); ok {
+			args[i].Value = int64(0)
+			if v {
+				args[i].Value = int64(1)
+			}
+		}
+	}
+	return args
+}
+
+func needsReturningID(query string) bool {
+	fields := strings.Fields(strings.TrimSpace(query))
+	if len(fields) < 3 || !strings.EqualFold(fields[0], "INSERT") || !strings.EqualFold(fields[1], "INTO") {
+		return false
+	}
+	if strings.Contains(strings.ToUpper(query), "RETURNING") {
+		return false
+	}
+
+	table := strings.ToLower(fields[2])
+	if i := strings.IndexByte(table, '('); i >= 0 {
+		table = table[:i]
+	}
+	return !tablesWithoutID[table]
+}
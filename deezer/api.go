@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -14,6 +15,7 @@ type Track struct {
 	Title    string `json:"title"`
 	Artist   string
 	Album    string
+	Cover    string
 	Duration int    `json:"duration"`
 	Preview  string `json:"preview"`
 }
@@ -23,7 +25,8 @@ type Artist struct {
 }
 
 type Album struct {
-	Title string `json:"title"`
+	Title       string `json:"title"`
+	CoverMedium string `json:"cover_medium"`
 }
 
 type TrackResponse struct {
@@ -39,10 +42,14 @@ type SearchResponse struct {
 	Data []TrackResponse `json:"data"`
 }
 
+// API Deezer et delai des requetes, fixes au demarrage par la configuration (deezer.*)
+var BaseURL = "https://api.deezer.com"
+var Client = &http.Client{Timeout: 10 * time.Second}
+
 func SearchTracks(query string) ([]Track, error) {
-	url := fmt.Sprintf("https://api.deezer.com/search?q=%s", query)
+	url := fmt.Sprintf("%s/search?q=%s", strings.TrimSuffix(BaseURL, "/"), query)
 	
-	resp, err := http.Get(url)
+	resp, err := Client.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +72,7 @@ func SearchTracks(query string) ([]Track, error) {
 			Title:    t.Title,
 			Artist:   t.Artist.Name,
 			Album:    t.Album.Title,
+			Cover:    t.Album.CoverMedium,
 			Duration: t.Duration,
 			Preview:  t.Preview,
 		}
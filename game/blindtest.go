@@ -3,6 +3,18 @@ package game
 import (
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"groupie-tracker/deezer"
+)
+
+// Reglages par defaut d'un blind test, fixes au demarrage par la configuration (game.*)
+var (
+	DefaultPlaylist        = "Pop"
+	DefaultResponseTime    = 37
+	DefaultBlindTestRounds = 10
 )
 
 type BlindTestConfig struct {
@@ -13,9 +25,34 @@ type BlindTestConfig struct {
 	NbrRounds    int
 }
 
-type ScoreboardEntry struct {
-	Pseudo string
-	Score  int
+type BlindTestRound struct {
+	ID            int
+	RoomID        int
+	RoundNumber   int
+	DeezerTrackID int64
+	Title         string
+	Artist        string
+	AlbumCover    string
+	StartedAt     time.Time
+	EndedAt       *time.Time
+}
+
+type BlindTestGuess struct {
+	RoundID      int
+	UserID       int
+	RawText      string
+	MatchedField string
+	ElapsedMs    int64
+	Points       int
+}
+
+type BlindTestRecapEntry struct {
+	RoundNumber   int
+	Title         string
+	Artist        string
+	AlbumCover    string
+	FirstFinder   string
+	FirstFinderMs int64
 }
 
 func CreateBlindTestConfig(db *sql.DB, roomID int, playlist string, responseTime int, nbrRounds int) error {
@@ -25,7 +62,10 @@ func CreateBlindTestConfig(db *sql.DB, roomID int, playlist string, responseTime
 	}
 
 	if responseTime == 0 {
-		responseTime = 37
+		responseTime = DefaultResponseTime
+	}
+	if nbrRounds == 0 {
+		nbrRounds = DefaultBlindTestRounds
 	}
 
 	_, err := db.Exec(`
@@ -58,4 +98,154 @@ func CalculateBlindTestPoints(position int, totalPlayers int) int {
 	return points
 }
 
-//pas pu finir
\ No newline at end of file
+func GetBlindTestConfig(db *sql.DB, roomID int) (*BlindTestConfig, error) {
+	var config BlindTestConfig
+
+	err := db.QueryRow(`
+		SELECT id, room_id, playlist, response_time, nbr_rounds
+		FROM blindtest_config
+		WHERE room_id = ?
+	`, roomID).Scan(&config.ID, &config.RoomID, &config.Playlist, &config.ResponseTime, &config.NbrRounds)
+
+	if err != nil {
+		return nil, errors.New("configuration introuvable")
+	}
+
+	return &config, nil
+}
+
+func StartBlindTestRound(db *sql.DB, roomID int, roundNumber int, track deezer.Track) (*BlindTestRound, error) {
+	startedAt := time.Now()
+
+	result, err := db.Exec(`
+		INSERT INTO blindtest_rounds (room_id, round_number, deezer_track_id, title, artist, album_cover, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, roomID, roundNumber, track.ID, track.Title, track.Artist, track.Cover, startedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	roundID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	round := &BlindTestRound{
+		ID:            int(roundID),
+		RoomID:        roomID,
+		RoundNumber:   roundNumber,
+		DeezerTrackID: track.ID,
+		Title:         track.Title,
+		Artist:        track.Artist,
+		AlbumCover:    track.Cover,
+		StartedAt:     startedAt,
+	}
+
+	return round, nil
+}
+
+func EndBlindTestRound(db *sql.DB, roundID int) error {
+	_, err := db.Exec(`
+		UPDATE blindtest_rounds
+		SET ended_at = ?
+		WHERE id = ? AND ended_at IS NULL
+	`, time.Now(), roundID)
+
+	return err
+}
+
+// Retourne "title", "artist" ou "" si la reponse ne correspond a rien
+func MatchBlindTestAnswer(answer string, round BlindTestRound) string {
+	normalized := normalizeAnswer(answer)
+	if normalized == "" {
+		return ""
+	}
+
+	if normalized == normalizeAnswer(round.Title) {
+		return "title"
+	}
+	if normalized == normalizeAnswer(round.Artist) {
+		return "artist"
+	}
+
+	return ""
+}
+
+func normalizeAnswer(answer string) string {
+	accents := strings.NewReplacer(
+		"à", "a", "â", "a", "ä", "a",
+		"é", "e", "è", "e", "ê", "e", "ë", "e",
+		"î", "i", "ï", "i",
+		"ô", "o", "ö", "o",
+		"ù", "u", "û", "u", "ü", "u",
+		"ç", "c",
+	)
+
+	answer = accents.Replace(strings.ToLower(answer))
+
+	var builder strings.Builder
+	for _, char := range answer {
+		if unicode.IsLetter(char) || unicode.IsNumber(char) {
+			builder.WriteRune(char)
+		}
+	}
+
+	return builder.String()
+}
+
+func SaveBlindTestGuess(db *sql.DB, guess BlindTestGuess) error {
+	var matchedField interface{}
+	if guess.MatchedField != "" {
+		matchedField = guess.MatchedField
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO blindtest_guesses (round_id, user_id, raw_text, matched_field, elapsed_ms, points)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, guess.RoundID, guess.UserID, guess.RawText, matchedField, guess.ElapsedMs, guess.Points)
+
+	return err
+}
+
+func SaveBlindTestScore(db *sql.DB, roomID int, userID int, roundNumber int, points int) error {
+	_, err := db.Exec(`
+		INSERT INTO scores (room_id, user_id, game_type, score, round_number)
+		VALUES (?, ?, 'blindtest', ?, ?)
+	`, roomID, userID, points, roundNumber)
+
+	return err
+}
+
+func GetBlindTestRecap(db *sql.DB, roomID int) ([]BlindTestRecapEntry, error) {
+	rows, err := db.Query(`
+		SELECT r.round_number, r.title, r.artist, COALESCE(r.album_cover, ''),
+			COALESCE(u.pseudo, ''), COALESCE(g.elapsed_ms, 0)
+		FROM blindtest_rounds r
+		LEFT JOIN blindtest_guesses g ON g.id = (
+			SELECT id FROM blindtest_guesses
+			WHERE round_id = r.id AND points > 0
+			ORDER BY elapsed_ms ASC
+			LIMIT 1
+		)
+		LEFT JOIN users u ON g.user_id = u.id
+		WHERE r.room_id = ?
+		ORDER BY r.round_number ASC
+	`, roomID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recap []BlindTestRecapEntry
+	for rows.Next() {
+		var entry BlindTestRecapEntry
+		err := rows.Scan(&entry.RoundNumber, &entry.Title, &entry.Artist, &entry.AlbumCover, &entry.FirstFinder, &entry.FirstFinderMs)
+		if err != nil {
+			return nil, err
+		}
+		recap = append(recap, entry)
+	}
+
+	return recap, nil
+}
\ No newline at end of file
@@ -8,7 +8,8 @@ import (
 	"time"
 )
 
-const nbrs_manche = 9 // Variable constante pour le choix du nombre de manche
+// Nombre de manches par defaut, fixe au demarrage par la configuration (game.petitbac_rounds)
+var DefaultPetitBacRounds = 9
 
 type PetitBacConfig struct {
 	ID           int
@@ -18,6 +19,10 @@ type PetitBacConfig struct {
 }
 
 func CreatePetitBacConfig(db *sql.DB, roomID int, responseTime int, nbrRounds int) error {
+	if nbrRounds == 0 {
+		nbrRounds = DefaultPetitBacRounds
+	}
+
 	_, err := db.Exec(`
 		INSERT INTO petitbac_config (room_id, response_time, nbr_rounds)
 		VALUES (?, ?, ?)
@@ -140,39 +145,93 @@ func CalculatePetitBacPoints(validations int, totalVoters int, isUnique bool) in
 	return 1
 }
 
-func SavePetitBacScore(db *sql.DB, roomID int, userID int, roundNumber int, scoreboardActualPointInGame int) error {
-	_, err := db.Exec(`
-		INSERT INTO scores (room_id, user_id, game_type, score, round_number)
-		VALUES (?, ?, 'petitbac', ?, ?)
-	`, roomID, userID, scoreboardActualPointInGame, roundNumber)
+// Categories jouees dans une partie
+const PetitBacCategoryCount = 5
 
-	return err
+var ErrInvalidCategories = errors.New("il faut choisir 5 categories differentes")
+
+func ValidatePetitBacCategories(categories []string) error {
+	if len(categories) != PetitBacCategoryCount {
+		return ErrInvalidCategories
+	}
+
+	seen := make(map[string]bool)
+	for _, category := range categories {
+		key := normalizeAnswer(category)
+		if key == "" || len([]rune(category)) > 40 || seen[key] {
+			return ErrInvalidCategories
+		}
+		seen[key] = true
+	}
+	return nil
 }
 
-func GetPetitBacScoreboard(db *sql.DB, roomID int) ([]ScoreboardEntry, error) {
-	rows, err := db.Query(`
-		SELECT u.pseudo, SUM(s.score) as total_score
-		FROM scores s
-		JOIN users u ON s.user_id = u.id
-		WHERE s.room_id = ? AND s.game_type = 'petitbac'
-		GROUP BY u.id, u.pseudo
-		ORDER BY total_score DESC
-	`, roomID)
+// Remplace les categories de la salle par celles choisies par l'hote
+func SetPetitBacCategories(db *sql.DB, roomID int, categories []string) error {
+	if err := ValidatePetitBacCategories(categories); err != nil {
+		return err
+	}
 
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var scoreboard []ScoreboardEntry
-	for rows.Next() {
-		var entry ScoreboardEntry
-		err := rows.Scan(&entry.Pseudo, &entry.Score)
-		if err != nil {
-			return nil, err
+	if _, err := tx.Exec("DELETE FROM petitbac_categories WHERE room_id = ?", roomID); err != nil {
+		return err
+	}
+	for _, category := range categories {
+		if _, err := tx.Exec("INSERT INTO petitbac_categories (room_id, category_name) VALUES (?, ?)", roomID, category); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Reponse d'un joueur dans une categorie. Rejections compte les autres joueurs
+// qui l'ont refusee pendant la correction.
+type PetitBacAnswer struct {
+	UserID     int    `json:"user_id"`
+	Pseudo     string `json:"pseudo"`
+	Category   string `json:"category"`
+	Text       string `json:"answer"`
+	Rejections int    `json:"-"`
+	Valid      bool   `json:"valid"`
+	Points     int    `json:"points"`
+}
+
+// Calcule Valid et Points de chaque reponse de la manche. voters est le nombre
+// de joueurs pouvant corriger une reponse (tous sauf son auteur) : un vote
+// absent vaut acceptation. Une reponse valide donnee par un seul joueur dans
+// sa categorie rapporte 2 points, sinon 1.
+func ScorePetitBacRound(answers []PetitBacAnswer, letter string, voters int) {
+	given := make(map[string]int)
+	for i := range answers {
+		answer := &answers[i]
+		answer.Valid = ValidateAnswer(answer.Text, letter) &&
+			CalculatePetitBacPoints(voters-answer.Rejections, voters, false) > 0
+		if answer.Valid {
+			given[answer.Category+"\x00"+normalizeAnswer(answer.Text)]++
+		}
+	}
+
+	for i := range answers {
+		answer := &answers[i]
+		answer.Points = 0
+		if answer.Valid {
+			isUnique := given[answer.Category+"\x00"+normalizeAnswer(answer.Text)] == 1
+			answer.Points = CalculatePetitBacPoints(voters-answer.Rejections, voters, isUnique)
 		}
-		scoreboard = append(scoreboard, entry)
 	}
+}
+
+func SavePetitBacScore(db *sql.DB, roomID int, userID int, roundNumber int, scoreboardActualPointInGame int) error {
+	_, err := db.Exec(`
+		INSERT INTO scores (room_id, user_id, game_type, score, round_number)
+		VALUES (?, ?, 'petitbac', ?, ?)
+	`, roomID, userID, scoreboardActualPointInGame, roundNumber)
 
-	return scoreboard, nil
-}
\ No newline at end of file
+	return err
+}
@@ -0,0 +1,65 @@
+package game
+
+import "testing"
+
+func TestCalculatePetitBacPoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		validations int
+		voters      int
+		isUnique    bool
+		want        int
+	}{
+		{"2 sur 3", 2, 3, false, 1},
+		{"1 sur 3", 1, 3, false, 0},
+		{"3 sur 4", 3, 4, false, 1},
+		{"2 sur 4", 2, 4, false, 1},
+		{"1 sur 4", 1, 4, false, 0},
+		{"un seul adversaire qui refuse", 0, 1, false, 1},
+		{"reponse unique", 2, 3, true, 2},
+		{"reponse unique refusee", 1, 3, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculatePetitBacPoints(tt.validations, tt.voters, tt.isUnique); got != tt.want {
+				t.Errorf("CalculatePetitBacPoints(%d, %d, %v) = %d, attendu %d", tt.validations, tt.voters, tt.isUnique, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAnswer(t *testing.T) {
+	tests := []struct {
+		answer string
+		letter string
+		want   bool
+	}{
+		{"Paris", "P", true},
+		{"paris", "P", true},
+		{"Lyon", "p", false},
+		{"", "P", false},
+	}
+	for _, tt := range tests {
+		if got := ValidateAnswer(tt.answer, tt.letter); got != tt.want {
+			t.Errorf("ValidateAnswer(%q, %q) = %v, attendu %v", tt.answer, tt.letter, got, tt.want)
+		}
+	}
+}
+
+func TestScorePetitBacRound(t *testing.T) {
+	answers := []PetitBacAnswer{
+		{UserID: 1, Category: "Ville", Text: "Paris"},
+		{UserID: 2, Category: "Ville", Text: "paris"},
+		{UserID: 3, Category: "Ville", Text: "Perpignan"},
+		{UserID: 1, Category: "Pays", Text: "Portugal", Rejections: 2},
+		{UserID: 2, Category: "Pays", Text: "Espagne"},
+	}
+	ScorePetitBacRound(answers, "P", 2)
+
+	want := []int{1, 1, 2, 0, 0}
+	for i, answer := range answers {
+		if answer.Points != want[i] {
+			t.Errorf("%s de %d: %d points, attendu %d", answer.Text, answer.UserID, answer.Points, want[i])
+		}
+	}
+}
@@ -6,8 +6,10 @@ toolchain go1.24.11
 
 require (
 	github.com/gorilla/websocket v1.5.1
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.18
 	golang.org/x/crypto v0.46.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/net v0.47.0 // indirect
@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Un Mailer envoie les mails transactionnels (verification, mot de passe oublie)
+type Mailer interface {
+	Send(msg Message) error
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(addr, auth, m.From, []string{msg.To}, formatMessage(m.From, msg))
+}
+
+// Pour le developpement : les mails sont ecrits dans un fichier (ou dans les logs
+// si Path est vide) au lieu d'etre envoyes
+type FileMailer struct {
+	Path string
+	From string
+
+	mu sync.Mutex
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if m.Path == "" {
+		log.Printf("Mail pour %s : %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\r\n", formatMessage(m.From, msg))
+	return err
+}
+
+func formatMessage(from string, msg Message) []byte {
+	// Les retours a la ligne sont retires des en-tetes pour eviter toute injection
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", clean.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", clean.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", clean.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -1,63 +1,527 @@
 package main
 
 import (
-	"html/template"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"groupie-tracker/achievement"
+	"groupie-tracker/admin"
 	"groupie-tracker/auth"
+	"groupie-tracker/auth/oidcmock"
+	"groupie-tracker/config"
 	"groupie-tracker/database"
+	"groupie-tracker/deezer"
+	"groupie-tracker/game"
+	"groupie-tracker/mailer"
+	"groupie-tracker/rating"
+	"groupie-tracker/render"
 	"groupie-tracker/room"
+	"groupie-tracker/scoreboard"
+	"groupie-tracker/store"
 )
 
+// Templates et fichiers statiques : le binaire se suffit a lui-meme
+//
+//go:embed templates static
+var assets embed.FS
+
 func main() {
-	err := database.InitDB("groupie_tracker.db")
+	// go run main.go [-config fichier.yaml] [-flags...] [migrate|backup|export|import ...]
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Erreur configuration: ", err)
+	}
+	applyConfig(cfg)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			runMigrate(cfg, args[1:])
+		case "backup":
+			runBackup(cfg, args[1:])
+		case "export":
+			runExport(cfg, args[1:])
+		case "import":
+			runImport(cfg, args[1:])
+		default:
+			log.Fatal("Commande inconnue: ", args[0], " (migrate, backup, export ou import)")
+		}
+		return
+	}
+
+	// Une erreur de syntaxe dans un template arrete le demarrage
+	templates, err := newRenderer(cfg.Server)
+	if err != nil {
+		log.Fatal("Erreur chargement des templates: ", err)
+	}
+	auth.Templates = templates
+
+	db, err := database.InitDB(cfg.Database.Driver, cfg.Database.URL)
 	if err != nil {
 		log.Fatal("Erreur initialisation BDD:", err)
 	}
-	defer database.CloseDB()
+	defer database.CloseDB(db)
 
-	hub := room.NewHub()
+	if err := auth.BackfillPseudoKeys(db); err != nil {
+		log.Fatal("Erreur calcul des cles de pseudo:", err)
+	}
+
+	hub := room.NewHub(db)
 	go hub.Run()
 
-	setupRoutes(hub)
+	go auth.StartSessionCleanup(db, time.Hour)
+
+	// Sauvegardes periodiques : database.backup_dir (GROUPIE_BACKUP_DIR=backups)
+	if dir := cfg.Database.BackupDir; dir != "" {
+		go database.StartBackupSchedule(db, dir, cfg.Database.BackupInterval, cfg.Database.BackupKeep)
+		log.Printf("Sauvegarde BDD toutes les %s dans %s (%d conservees)", cfg.Database.BackupInterval, dir, cfg.Database.BackupKeep)
+	}
+
+	// Premier administrateur : GROUPIE_ADMIN_PSEUDO=MonPseudo au demarrage
+	if pseudo := cfg.Server.AdminPseudo; pseudo != "" {
+		if err := admin.PromoteAdmin(db, pseudo); err != nil {
+			log.Printf("Erreur promotion administrateur %s: %v", pseudo, err)
+		}
+	}
+
+	a := &app{
+		stores:    store.NewSQL(db),
+		db:        db,
+		hub:       hub,
+		cfg:       cfg,
+		templates: templates,
+	}
+	setupRoutes(a, newMailer(cfg.Mail), newOIDCProvider(cfg))
+
+	server := &http.Server{Addr: cfg.Server.Addr, Handler: hsts(http.DefaultServeMux, cfg.Server.HSTSMaxAge)}
+
+	// Ctrl+C ou SIGTERM : on arrete d'accepter des requetes, les parties sont
+	// interrompues proprement puis la base est fermee par le defer
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		log.Println("Serveur demarre sur", siteURL(cfg))
+		if cfg.Server.TLS() {
+			serverErr <- server.ListenAndServeTLS(cfg.Server.TLSCert, cfg.Server.TLSKey)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	// Les visiteurs arrivant en http:// sont renvoyes vers https://
+	var redirectServer *http.Server
+	if cfg.Server.RedirectAddr != "" {
+		redirectServer = &http.Server{Addr: cfg.Server.RedirectAddr, Handler: httpsRedirect(cfg)}
+		go func() {
+			log.Println("Redirection HTTP vers HTTPS sur", cfg.Server.RedirectAddr)
+			serverErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+	log.Println("Arret du serveur...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Erreur arret HTTP: %v", err)
+	}
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Erreur arret des salles: %v", err)
+	}
+	log.Println("Serveur arrete")
+}
+
+// Reporte la configuration dans les reglages des paquets
+func applyConfig(cfg *config.Config) {
+	auth.PublicURL = strings.TrimSuffix(cfg.Server.PublicURL, "/")
+	auth.SecureCookies = cfg.Server.TLS() || strings.HasPrefix(auth.PublicURL, "https://")
+	// Liste deja verifiee par config.Validate
+	auth.TrustedProxies, _ = cfg.Server.TrustedProxyNets()
+	auth.SessionDuration = cfg.Auth.SessionTTL
+	auth.RememberMeDuration = cfg.Auth.RememberMeTTL
+	auth.GuestSessionDuration = cfg.Auth.GuestSessionTTL
+	auth.BcryptCost = cfg.Auth.BcryptCost
+
+	room.MaxPlayers = cfg.Game.MaxPlayers
+	room.ReadBufferSize = cfg.WebSocket.ReadBufferSize
+	room.WriteBufferSize = cfg.WebSocket.WriteBufferSize
+	room.MaxMessageSize = cfg.WebSocket.MaxMessageSize
+	room.SendQueueSize = cfg.WebSocket.SendQueueSize
+
+	game.DefaultPlaylist = cfg.Game.BlindTestPlaylist
+	game.DefaultResponseTime = cfg.Game.BlindTestResponseTime
+	game.DefaultBlindTestRounds = cfg.Game.BlindTestRounds
+	game.DefaultPetitBacRounds = cfg.Game.PetitBacRounds
+
+	deezer.BaseURL = cfg.Deezer.BaseURL
+	deezer.Client.Timeout = cfg.Deezer.Timeout
+}
+
+// Adresse a laquelle le site est joignable : server.public_url, sinon l'adresse d'ecoute
+func siteURL(cfg *config.Config) string {
+	if auth.PublicURL != "" {
+		return auth.PublicURL
+	}
+	scheme := "http://"
+	if cfg.Server.TLS() {
+		scheme = "https://"
+	}
+	if strings.HasPrefix(cfg.Server.Addr, ":") {
+		return scheme + "localhost" + cfg.Server.Addr
+	}
+	return scheme + cfg.Server.Addr
+}
 
-	log.Println("Serveur demarre sur http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// Demande au navigateur de ne plus revenir qu'en HTTPS (RFC 6797). L'en-tete
+// n'est envoye que sur les reponses HTTPS, il est ignore en HTTP.
+func hsts(next http.Handler, maxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maxAge > 0 && auth.IsHTTPS(r) {
+			w.Header().Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(maxAge.Seconds())))
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func setupRoutes(hub *room.Hub) {
-	fs := http.FileServer(http.Dir("static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+// Ecouteur server.redirect_addr : renvoie chaque requete vers la meme page en HTTPS
+func httpsRedirect(cfg *config.Config) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(cfg.Server.Addr)
 
-	http.HandleFunc("/register", auth.RegisterHandler(database.DB))
-	http.HandleFunc("/login", auth.LoginHandler(database.DB))
-	http.HandleFunc("/logout", auth.LogoutHandler(database.DB))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := auth.PublicURL
+		if !strings.HasPrefix(target, "https://") {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if tlsPort != "" && tlsPort != "443" {
+				host = net.JoinHostPort(host, tlsPort)
+			}
+			target = "https://" + host
+		}
+		http.Redirect(w, r, target+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
 
-	http.HandleFunc("/", auth.AuthMiddleware(database.DB, landingPageHandler))
-	http.HandleFunc("/room/create", auth.AuthMiddleware(database.DB, createRoomHandler))
-	http.HandleFunc("/room/join", auth.AuthMiddleware(database.DB, joinRoomHandler))
-	http.HandleFunc("/room/", auth.AuthMiddleware(database.DB, roomHandler))
+// go run main.go migrate [up|down [n]|to <version>|status]
+func runMigrate(cfg *config.Config, args []string) {
+	db, err := database.OpenDB(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatal("Erreur ouverture BDD:", err)
+	}
+	defer database.CloseDB(db)
 
-	http.HandleFunc("/ws", auth.AuthMiddleware(database.DB, func(w http.ResponseWriter, r *http.Request) {
-		websocketHandler(hub, w, r)
-	}))
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		err = database.Migrate(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatal("Nombre de migrations a annuler invalide: ", args[1])
+			}
+		}
+		err = database.Rollback(db, steps)
+	case "to":
+		if len(args) < 2 {
+			log.Fatal("Usage: migrate to <version>")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			log.Fatal("Version invalide: ", args[1])
+		}
+		err = database.MigrateTo(db, version)
+	case "status":
+	default:
+		log.Fatal("Usage: migrate [up|down [n]|to <version>|status]")
+	}
+	if err != nil {
+		log.Fatal("Erreur migration: ", err)
+	}
+
+	statuses, err := database.Status(db)
+	if err != nil {
+		log.Fatal("Erreur lecture des migrations: ", err)
+	}
+	for _, s := range statuses {
+		state := "en attente"
+		if s.Applied {
+			state = "appliquee le " + s.AppliedAt.Format("02/01/2006 15:04")
+		}
+		if s.Unknown {
+			state += " (inconnue de ce binaire)"
+		}
+		fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, state)
+	}
+}
+
+// go run main.go backup <fichier.db>
+func runBackup(cfg *config.Config, args []string) {
+	if len(args) != 1 {
+		log.Fatal("Usage: backup <fichier.db>")
+	}
+
+	db, err := database.OpenDB(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatal("Erreur ouverture BDD:", err)
+	}
+	defer database.CloseDB(db)
+
+	if err := database.Backup(db, args[0]); err != nil {
+		log.Fatal("Erreur sauvegarde: ", err)
+	}
+	log.Printf("Sauvegarde ecrite dans %s", args[0])
 }
 
-func landingPageHandler(w http.ResponseWriter, r *http.Request) {
+// go run main.go export <fichier.json> [--no-password-hashes]
+func runExport(cfg *config.Config, args []string) {
+	if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "--no-password-hashes") {
+		log.Fatal("Usage: export <fichier.json> [--no-password-hashes]")
+	}
+	withHashes := len(args) == 1
+
+	db, err := database.InitDB(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatal("Erreur initialisation BDD:", err)
+	}
+	defer database.CloseDB(db)
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		log.Fatal("Erreur creation du fichier: ", err)
+	}
+	defer file.Close()
+
+	if err := database.ExportJSON(db, file, withHashes); err != nil {
+		log.Fatal("Erreur export: ", err)
+	}
+	log.Printf("Export ecrit dans %s", args[0])
+}
+
+// go run main.go import <fichier.json>, dans une base vide
+func runImport(cfg *config.Config, args []string) {
+	if len(args) != 1 {
+		log.Fatal("Usage: import <fichier.json>")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Fatal("Erreur ouverture du fichier: ", err)
+	}
+	defer file.Close()
+
+	db, err := database.InitDB(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatal("Erreur initialisation BDD:", err)
+	}
+	defer database.CloseDB(db)
+
+	export, err := database.ImportJSON(db, file)
+	if err != nil {
+		log.Fatal("Erreur import: ", err)
+	}
+	log.Printf("Import termine : %d utilisateurs, %d salles, %d scores", len(export.Users), len(export.Rooms), len(export.Scores))
+	if !export.PasswordHashes {
+		log.Println("Export sans mots de passe : les comptes devront utiliser \"Mot de passe oublie\"")
+	}
+}
+
+// SMTP si mail.smtp_host est defini, sinon les mails sont ecrits dans mail.log_file
+func newMailer(cfg config.MailConfig) mailer.Mailer {
+	if cfg.SMTPHost == "" {
+		log.Printf("SMTP non configure, les mails sont ecrits dans %s", cfg.LogFile)
+		return &mailer.FileMailer{Path: cfg.LogFile, From: cfg.From}
+	}
+
+	return &mailer.SMTPMailer{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.From,
+	}
+}
+
+// Connexion OIDC si oidc.issuer est defini. oidc.mock (GROUPIE_OIDC_MOCK=1) active le
+// fournisseur de test integre sous /oidc-mock, sans aucun service externe.
+func newOIDCProvider(cfg *config.Config) *auth.OIDCProvider {
+	issuer := cfg.OIDC.Issuer
+	clientID := cfg.OIDC.ClientID
+	clientSecret := cfg.OIDC.ClientSecret
+	name := cfg.OIDC.Name
+
+	if cfg.OIDC.Mock {
+		issuer = siteURL(cfg) + "/oidc-mock"
+		clientID, clientSecret, name = "groupie-tracker", "mock-secret", "le fournisseur de test"
+
+		http.Handle("/oidc-mock/", http.StripPrefix("/oidc-mock", oidcmock.NewServer(issuer, clientID, clientSecret)))
+		log.Println("Fournisseur OIDC de test actif sur", issuer)
+	}
+
+	if issuer == "" {
+		return nil
+	}
+	if name == "" {
+		name = "SSO"
+	}
+
+	provider := auth.NewOIDCProvider(name, issuer, clientID, clientSecret)
+	if auth.PublicURL != "" {
+		provider.RedirectURL = auth.PublicURL + "/auth/oidc/callback"
+	}
+	return provider
+}
+
+// Dependances des handlers de pages. Seul le retour OIDC, qui lie les comptes
+// dans une transaction (auth.FindOrCreateOIDCUser), recoit directement la base.
+type app struct {
+	stores    *store.Stores
+	db        *sql.DB
+	hub       *room.Hub
+	cfg       *config.Config
+	templates *render.Renderer
+}
+
+// Templates embarques dans le binaire, sauf si server.templates_dir est donne.
+// En mode dev ils sont relus a chaque page, depuis ./templates par defaut.
+func newRenderer(cfg config.ServerConfig) (*render.Renderer, error) {
+	templates, err := fs.Sub(assets, "templates")
+	if err != nil {
+		return nil, err
+	}
+	dir := cfg.TemplatesDir
+	if dir == "" && cfg.Dev {
+		dir = "templates"
+	}
+	if dir != "" {
+		templates = os.DirFS(dir)
+	}
+
+	funcs := auth.CSRFFuncs(nil)
+	funcs["inc"] = func(i int) int { return i + 1 }
+
+	renderer, err := render.New(templates, funcs, cfg.Dev)
+	if err != nil {
+		return nil, err
+	}
+	renderer.RequestFuncs = auth.CSRFFuncs
+	return renderer, nil
+}
+
+// Fichiers statiques embarques, ou lus dans server.static_dir (./static en mode dev)
+func staticFiles(cfg config.ServerConfig) (http.FileSystem, error) {
+	dir := cfg.StaticDir
+	if dir == "" && cfg.Dev {
+		dir = "static"
+	}
+	if dir != "" {
+		return http.Dir(dir), nil
+	}
+
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		return nil, err
+	}
+	return http.FS(static), nil
+}
+
+func setupRoutes(a *app, m mailer.Mailer, oidc *auth.OIDCProvider) {
+	static, err := staticFiles(a.cfg.Server)
+	if err != nil {
+		log.Fatal("Erreur fichiers statiques: ", err)
+	}
+	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(static)))
+
+	accounts := a.stores.Accounts()
+
+	http.HandleFunc("/register", auth.CSRFMiddleware(auth.RegisterHandler(accounts, m)))
+	http.HandleFunc("/login", auth.CSRFMiddleware(auth.LoginHandler(accounts, m, oidc)))
+	if oidc != nil {
+		http.HandleFunc("/auth/oidc/login", auth.OIDCLoginHandler(oidc))
+		http.HandleFunc("/auth/oidc/callback", auth.OIDCCallbackHandler(a.db, oidc))
+	}
+	http.HandleFunc("/verify-email", auth.VerifyEmailHandler(accounts))
+	http.HandleFunc("/forgot-password", auth.CSRFMiddleware(auth.ForgotPasswordHandler(accounts, m)))
+	http.HandleFunc("/reset-password", auth.CSRFMiddleware(auth.ResetPasswordHandler(accounts)))
+	http.HandleFunc("/logout", auth.CSRFMiddleware(auth.LogoutHandler(a.stores.Sessions)))
+	http.HandleFunc("/account", auth.CSRFMiddleware(auth.AuthMiddleware(a.stores.Sessions, auth.AccountHandler(accounts, m))))
+	http.HandleFunc("/account/email/confirm", auth.ConfirmEmailChangeHandler(accounts))
+	http.HandleFunc("/account/sessions", auth.CSRFMiddleware(auth.AuthMiddleware(a.stores.Sessions, auth.SessionsHandler(a.stores.Sessions))))
+
+	http.HandleFunc("/leaderboard", a.leaderboardHandler)
+	http.HandleFunc("/user/", auth.CSRFMiddleware(auth.OptionalAuthMiddleware(a.stores.Sessions, a.profileHandler)))
+	http.HandleFunc("/report", auth.CSRFMiddleware(auth.AuthMiddleware(a.stores.Sessions, a.reportHandler)))
+
+	http.HandleFunc("/admin", auth.CSRFMiddleware(auth.RequireRole(a.stores.Sessions, auth.RoleModerator, a.adminHandler)))
+
+	http.HandleFunc("/", auth.CSRFMiddleware(auth.AuthMiddleware(a.stores.Sessions, a.landingPageHandler)))
+	http.HandleFunc("/room/create", auth.CSRFMiddleware(auth.AuthMiddleware(a.stores.Sessions, a.createRoomHandler)))
+	http.HandleFunc("/room/join", auth.CSRFMiddleware(auth.AuthMiddleware(a.stores.Sessions, a.joinRoomHandler)))
+	http.HandleFunc("/room/", auth.CSRFMiddleware(auth.OptionalAuthMiddleware(a.stores.Sessions, a.roomHandler)))
+
+	http.HandleFunc("/ws", auth.AuthMiddleware(a.stores.Sessions, a.websocketHandler))
+}
+
+func (a *app) landingPageHandler(w http.ResponseWriter, r *http.Request) {
 	pseudo := auth.GetUserPseudo(r)
 
+	suggestions, err := a.stores.Ratings.SuggestRooms(auth.GetUserID(r), 5)
+	if err != nil {
+		log.Printf("Erreur suggestion de salles: %v", err)
+	}
+
 	data := struct {
-		Pseudo string
+		Pseudo      string
+		IsGuest     bool
+		IsModerator bool
+		Suggestions []rating.SuggestedRoom
 	}{
-		Pseudo: pseudo,
+		Pseudo:      pseudo,
+		IsGuest:     auth.IsGuest(r),
+		IsModerator: auth.HasRole(auth.GetUserRole(r), auth.RoleModerator),
+		Suggestions: suggestions,
 	}
 
-	tmpl := template.Must(template.ParseFiles("templates/landing.html"))
-	tmpl.Execute(w, data)
+	a.templates.Render(w, r, "landing.html", data)
 }
 
-func createRoomHandler(w http.ResponseWriter, r *http.Request) {
+func (a *app) createRoomHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Methode non autorisee", http.StatusMethodNotAllowed)
 		return
@@ -65,17 +529,18 @@ func createRoomHandler(w http.ResponseWriter, r *http.Request) {
 
 	userID := auth.GetUserID(r)
 	gameType := r.FormValue("game_type")
+	isPublic := r.FormValue("public") == "1"
 
-	newRoom, err := room.CreateRoom(database.DB, gameType, userID)
+	newRoom, err := a.stores.Rooms.Create(gameType, userID, isPublic)
 	if err != nil {
-		http.Error(w, "Erreur creation salle: "+err.Error(), http.StatusInternalServerError)
+		roomError(w, "Erreur creation salle", err)
 		return
 	}
 
 	http.Redirect(w, r, "/room/"+newRoom.Code, http.StatusSeeOther)
 }
 
-func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
+func (a *app) joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Methode non autorisee", http.StatusMethodNotAllowed)
 		return
@@ -84,67 +549,429 @@ func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserID(r)
 	roomCode := r.FormValue("room_code")
 
-	err := room.JoinRoom(database.DB, roomCode, userID)
-	if err != nil {
-		http.Error(w, "Erreur: "+err.Error(), http.StatusBadRequest)
+	// Deja dans la salle : on y retourne simplement
+	err := a.stores.Rooms.Join(roomCode, userID)
+	if err != nil && !errors.Is(err, room.ErrAlreadyJoined) {
+		roomError(w, "Erreur", err)
 		return
 	}
 
 	http.Redirect(w, r, "/room/"+roomCode, http.StatusSeeOther)
 }
 
-func roomHandler(w http.ResponseWriter, r *http.Request) {
-	roomCode := r.URL.Path[len("/room/"):]
+// Les erreurs connues de room sont affichees au joueur, les autres journalisees
+func roomError(w http.ResponseWriter, prefix string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, room.ErrRoomNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, room.ErrRoomFull), errors.Is(err, room.ErrGameAlreadyStarted), errors.Is(err, room.ErrAlreadyJoined):
+		status = http.StatusConflict
+	case errors.Is(err, room.ErrInvalidGameType):
+		status = http.StatusBadRequest
+	}
+
+	if status == http.StatusInternalServerError {
+		log.Printf("%s: %v", prefix, err)
+		http.Error(w, prefix, status)
+		return
+	}
+	http.Error(w, prefix+": "+err.Error(), status)
+}
+
+func (a *app) guestJoinHandler(w http.ResponseWriter, r *http.Request, roomCode string) {
+	if r.Method != "POST" {
+		http.Error(w, "Methode non autorisee", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if auth.GetUserID(r) != 0 {
+		http.Error(w, "Deja connecte", http.StatusBadRequest)
+		return
+	}
 
-	currentRoom, err := room.GetRoomByCode(database.DB, roomCode)
+	// On verifie la salle avant de creer l'invite pour ne pas laisser de compte inutile
+	currentRoom, err := a.stores.Rooms.GetByCode(roomCode)
 	if err != nil {
 		http.Error(w, "Salle introuvable", http.StatusNotFound)
 		return
 	}
+	if currentRoom.Status != "waiting" {
+		roomError(w, "Erreur", room.ErrGameAlreadyStarted)
+		return
+	}
+	if len(currentRoom.Players) >= currentRoom.MaxPlayers {
+		roomError(w, "Erreur", room.ErrRoomFull)
+		return
+	}
+
+	guest, err := a.stores.Users.CreateGuest(r.FormValue("pseudo"))
+	if errors.Is(err, auth.ErrPseudoTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := a.stores.Sessions.CreateGuest(guest.ID, r.UserAgent(), auth.ClientIP(r))
+	if err != nil {
+		http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+		return
+	}
+	auth.SetSessionCookie(w, token, auth.GuestSessionDuration)
+
+	if err := a.stores.Rooms.Join(roomCode, guest.ID); err != nil {
+		roomError(w, "Erreur", err)
+		return
+	}
+
+	http.Redirect(w, r, "/room/"+roomCode, http.StatusSeeOther)
+}
+
+func (a *app) roomHandler(w http.ResponseWriter, r *http.Request) {
+	roomCode := r.URL.Path[len("/room/"):]
+
+	if strings.HasSuffix(roomCode, "/guest") {
+		a.guestJoinHandler(w, r, strings.TrimSuffix(roomCode, "/guest"))
+		return
+	}
 
 	userID := auth.GetUserID(r)
-	isInRoom := false
-	for _, player := range currentRoom.Players {
-		if player.UserID == userID {
-			isInRoom = true
-			break
+
+	if strings.HasSuffix(roomCode, "/recap") {
+		if userID == 0 {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
 		}
+		a.recapHandler(w, r, strings.TrimSuffix(roomCode, "/recap"))
+		return
+	}
+
+	currentRoom, err := a.stores.Rooms.GetByCode(roomCode)
+	if err != nil {
+		http.Error(w, "Salle introuvable", http.StatusNotFound)
+		return
 	}
 
-	if !isInRoom {
+	// Visiteur sans compte : il peut rejoindre la salle en invite avec un simple pseudo
+	if userID == 0 {
+		a.templates.Render(w, r, "guest.html", currentRoom)
+		return
+	}
+
+	if !currentRoom.HasPlayer(userID) {
 		http.Error(w, "Vous n'etes pas dans cette salle", http.StatusForbidden)
 		return
 	}
 
+	badges, err := a.stores.Achievements.ForRoom(currentRoom.ID)
+	if err != nil {
+		log.Printf("Erreur badges salle %d: %v", currentRoom.ID, err)
+	}
+
 	data := struct {
 		Room    *room.Room
 		IsReady bool
 		UserID  int
+		Badges  map[int][]achievement.Achievement
 	}{
 		Room:    currentRoom,
 		IsReady: room.IsRoomReady(*currentRoom),
 		UserID:  userID,
+		Badges:  badges,
 	}
 
 	if currentRoom.GameType == "blindtest" {
-		tmpl := template.Must(template.ParseFiles("templates/blindtest.html"))
-		tmpl.Execute(w, data)
+		a.templates.Render(w, r, "blindtest.html", data)
 	} else {
-		tmpl := template.Must(template.ParseFiles("templates/petitbac.html"))
-		tmpl.Execute(w, data)
+		a.templates.Render(w, r, "petitbac.html", data)
+	}
+}
+
+func (a *app) recapHandler(w http.ResponseWriter, r *http.Request, roomCode string) {
+	currentRoom, err := a.stores.Rooms.GetByCode(roomCode)
+	if err != nil || currentRoom.GameType != "blindtest" {
+		http.Error(w, "Salle introuvable", http.StatusNotFound)
+		return
+	}
+
+	recap, err := a.stores.Scores.BlindTestRecap(currentRoom.ID)
+	if err != nil {
+		http.Error(w, "Erreur chargement recap", http.StatusInternalServerError)
+		return
 	}
+
+	data := struct {
+		Room  *room.Room
+		Recap []game.BlindTestRecapEntry
+	}{
+		Room:  currentRoom,
+		Recap: recap,
+	}
+
+	a.templates.Render(w, r, "recap.html", data)
 }
 
-func websocketHandler(hub *room.Hub, w http.ResponseWriter, r *http.Request) {
+func (a *app) leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	days, ok := scoreboard.LeaderboardPeriods[period]
+	if !ok {
+		period = "all"
+	}
+
+	leaderboard, err := a.stores.Scores.Leaderboard(days, 50)
+	if err != nil {
+		http.Error(w, "Erreur chargement classement", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Period      string
+		Leaderboard []scoreboard.LeaderboardEntry
+	}{
+		Period:      period,
+		Leaderboard: leaderboard,
+	}
+
+	a.templates.Render(w, r, "leaderboard.html", data)
+}
+
+func (a *app) profileHandler(w http.ResponseWriter, r *http.Request) {
+	pseudo := r.URL.Path[len("/user/"):]
+
+	stats, err := a.stores.Scores.PlayerStats(pseudo)
+	if err != nil {
+		http.Error(w, "Joueur introuvable", http.StatusNotFound)
+		return
+	}
+
+	ratings, err := a.stores.Ratings.ForUser(stats.UserID)
+	if err != nil {
+		http.Error(w, "Erreur chargement profil", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := a.stores.Ratings.History(stats.UserID, 10)
+	if err != nil {
+		http.Error(w, "Erreur chargement profil", http.StatusInternalServerError)
+		return
+	}
+
+	achievements, err := a.stores.Achievements.ForUser(stats.UserID)
+	if err != nil {
+		http.Error(w, "Erreur chargement profil", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Stats        *scoreboard.PlayerStats
+		Ratings      map[string]rating.Rating
+		History      []rating.HistoryEntry
+		Achievements []achievement.UnlockedAchievement
+		CanReport    bool
+		Reported     bool
+	}{
+		Stats:        stats,
+		Ratings:      ratings,
+		History:      history,
+		Achievements: achievements,
+		CanReport:    auth.GetUserID(r) != 0 && auth.GetUserID(r) != stats.UserID,
+		Reported:     r.URL.Query().Get("reported") != "",
+	}
+
+	a.templates.Render(w, r, "profile.html", data)
+}
+
+func (a *app) reportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Methode non autorisee", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pseudo := r.FormValue("pseudo")
+	reported, err := a.stores.Users.GetByPseudo(pseudo)
+	if err != nil {
+		http.Error(w, "Joueur introuvable", http.StatusNotFound)
+		return
+	}
+
+	if err := a.stores.Admin.CreateReport(auth.GetUserID(r), reported.ID, r.FormValue("reason")); err != nil {
+		http.Error(w, "Erreur: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/user/"+url.PathEscape(pseudo)+"?reported=1", http.StatusSeeOther)
+}
+
+func (a *app) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		if err := a.adminAction(r); err != nil {
+			http.Error(w, "Erreur: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	search := r.URL.Query().Get("q")
+	users, err := a.stores.Admin.ListUsers(search, 100)
+	if err != nil {
+		http.Error(w, "Erreur chargement utilisateurs", http.StatusInternalServerError)
+		return
+	}
+
+	reports, err := a.stores.Admin.RecentReports(50)
+	if err != nil {
+		http.Error(w, "Erreur chargement signalements", http.StatusInternalServerError)
+		return
+	}
+
+	activeRooms := a.hub.ActiveRooms()
+	var roomIDs []int
+	for _, active := range activeRooms {
+		roomIDs = append(roomIDs, active.RoomID)
+	}
+
+	roomsInfo, err := a.stores.Admin.RoomsInfo(roomIDs)
+	if err != nil {
+		http.Error(w, "Erreur chargement salles", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Search      string
+		Users       []admin.User
+		Reports     []admin.Report
+		ActiveRooms []room.ActiveRoom
+		RoomsInfo   map[int]admin.RoomInfo
+		UserID      int
+		IsAdmin     bool
+		Roles       []string
+	}{
+		Search:      search,
+		Users:       users,
+		Reports:     reports,
+		ActiveRooms: activeRooms,
+		RoomsInfo:   roomsInfo,
+		UserID:      auth.GetUserID(r),
+		IsAdmin:     auth.HasRole(auth.GetUserRole(r), auth.RoleAdmin),
+		Roles:       []string{auth.RoleUser, auth.RoleModerator, auth.RoleAdmin},
+	}
+
+	a.templates.Render(w, r, "admin.html", data)
+}
+
+func (a *app) adminAction(r *http.Request) error {
+	actorID := auth.GetUserID(r)
+	actorRole := auth.GetUserRole(r)
+
+	// Un moderateur ne peut agir que sur les comptes de role inferieur au sien
+	checkTarget := func() (int, error) {
+		targetID, err := strconv.Atoi(r.FormValue("user_id"))
+		if err != nil {
+			return 0, errors.New("utilisateur invalide")
+		}
+		if targetID == actorID {
+			return 0, errors.New("action impossible sur ton propre compte")
+		}
+
+		targetRole, err := a.stores.Admin.UserRole(targetID)
+		if err != nil {
+			return 0, err
+		}
+		if auth.HasRole(targetRole, actorRole) {
+			return 0, errors.New("droits insuffisants sur ce compte")
+		}
+		return targetID, nil
+	}
+
+	switch r.FormValue("action") {
+	case "ban":
+		targetID, err := checkTarget()
+		if err != nil {
+			return err
+		}
+		if err := a.stores.Admin.Ban(targetID, r.FormValue("reason")); err != nil {
+			return err
+		}
+		log.Printf("Utilisateur %d banni par %d", targetID, actorID)
+
+	case "unban":
+		targetID, err := checkTarget()
+		if err != nil {
+			return err
+		}
+		return a.stores.Admin.Unban(targetID)
+
+	case "set_role":
+		if !auth.HasRole(actorRole, auth.RoleAdmin) {
+			return errors.New("reserve aux administrateurs")
+		}
+		role := r.FormValue("role")
+		if !auth.IsValidRole(role) {
+			return errors.New("role invalide")
+		}
+		targetID, err := checkTarget()
+		if err != nil {
+			return err
+		}
+		if err := a.stores.Admin.SetRole(targetID, role); err != nil {
+			return err
+		}
+		log.Printf("Role de l'utilisateur %d change en %s par %d", targetID, role, actorID)
+
+	case "close_room":
+		roomID, err := strconv.Atoi(r.FormValue("room_id"))
+		if err != nil {
+			return errors.New("salle invalide")
+		}
+		if err := a.hub.CloseRoom(roomID, "La salle a ete fermee par la moderation"); err != nil {
+			return err
+		}
+		log.Printf("Salle %d fermee par %d", roomID, actorID)
+
+	case "resolve_report":
+		reportID, err := strconv.Atoi(r.FormValue("report_id"))
+		if err != nil {
+			return errors.New("signalement invalide")
+		}
+		return a.stores.Admin.ResolveReport(reportID, actorID)
+
+	default:
+		return errors.New("action inconnue")
+	}
+
+	return nil
+}
+
+func (a *app) websocketHandler(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserID(r)
 	pseudo := auth.GetUserPseudo(r)
 
 	roomCode := r.URL.Query().Get("room")
-	currentRoom, err := room.GetRoomByCode(database.DB, roomCode)
+	currentRoom, err := a.stores.Rooms.GetByCode(roomCode)
 	if err != nil {
 		http.Error(w, "Salle introuvable", http.StatusNotFound)
 		return
 	}
 
-	room.ServeWS(hub, w, r, currentRoom.ID, userID, pseudo)
+	if currentRoom.Status == "closed" {
+		http.Error(w, "Salle fermee", http.StatusGone)
+		return
+	}
+	if currentRoom.Status == "interrupted" {
+		http.Error(w, "Partie interrompue par un redemarrage du serveur", http.StatusGone)
+		return
+	}
+
+	// Sans cette verification, connaitre le code suffirait pour jouer et marquer des points
+	if !currentRoom.HasPlayer(userID) {
+		http.Error(w, "Vous n'etes pas dans cette salle", http.StatusForbidden)
+		return
+	}
+
+	room.ServeWS(a.hub, w, r, currentRoom.ID, userID, pseudo)
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"groupie-tracker/auth"
+	"groupie-tracker/config"
+	"groupie-tracker/room"
+	"groupie-tracker/store"
+)
+
+// Application branchee sur les stores en memoire, avec les templates embarques
+func newTestApp(t *testing.T) *app {
+	t.Helper()
+	templates, err := newRenderer(config.ServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &app{
+		stores:    store.NewMemory(),
+		hub:       room.NewHub(nil),
+		cfg:       &config.Config{},
+		templates: templates,
+	}
+}
+
+// Cree un compte avec le role donne et retourne son id et son cookie de session
+func (a *app) testUser(t *testing.T, pseudo string, role string) (int, *http.Cookie) {
+	t.Helper()
+	user, err := a.stores.Users.Create(pseudo, strings.ToLower(pseudo)+"@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != auth.RoleUser {
+		if err := a.stores.Admin.SetRole(user.ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, err := a.stores.Sessions.Create(user.ID, "test", "192.0.2.1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID, &http.Cookie{Name: "session_token", Value: token}
+}
+
+func serve(handler http.HandlerFunc, method string, target string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestReportHandler(t *testing.T) {
+	a := newTestApp(t)
+	_, alice := a.testUser(t, "Alice", auth.RoleUser)
+	a.testUser(t, "Bob", auth.RoleUser)
+	handler := auth.AuthMiddleware(a.stores.Sessions, a.reportHandler)
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+	}{
+		{"joueur inconnu", url.Values{"pseudo": {"Personne"}, "reason": {"spam"}}, http.StatusNotFound},
+		{"sans raison", url.Values{"pseudo": {"Bob"}, "reason": {"  "}}, http.StatusBadRequest},
+		{"soi-meme", url.Values{"pseudo": {"Alice"}, "reason": {"spam"}}, http.StatusBadRequest},
+		{"signalement", url.Values{"pseudo": {"Bob"}, "reason": {"spam"}}, http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(handler, http.MethodPost, "/report", tt.form, alice); rec.Code != tt.wantStatus {
+				t.Errorf("statut %d, attendu %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	reports, err := a.stores.Admin.RecentReports(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].ReporterPseudo != "Alice" || reports[0].ReportedPseudo != "Bob" {
+		t.Errorf("signalements = %+v", reports)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	a := newTestApp(t)
+	_, moderator := a.testUser(t, "Modo", auth.RoleModerator)
+	adminID, _ := a.testUser(t, "Admin", auth.RoleAdmin)
+	bobID, bob := a.testUser(t, "Bob", auth.RoleUser)
+	handler := auth.RequireRole(a.stores.Sessions, auth.RoleModerator, a.adminHandler)
+
+	if rec := serve(handler, http.MethodGet, "/admin", nil, moderator); rec.Code != http.StatusOK {
+		t.Fatalf("page admin: statut %d, attendu %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(handler, http.MethodGet, "/admin", nil, bob); rec.Code == http.StatusOK {
+		t.Fatal("page admin accessible a un simple joueur")
+	}
+
+	action := func(values ...string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		for i := 0; i+1 < len(values); i += 2 {
+			form.Set(values[i], values[i+1])
+		}
+		return serve(handler, http.MethodPost, "/admin", form, moderator)
+	}
+
+	if rec := action("action", "ban", "user_id", strconv.Itoa(adminID), "reason", "test"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bannir un administrateur: statut %d, attendu %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := action("action", "set_role", "user_id", strconv.Itoa(bobID), "role", auth.RoleModerator); rec.Code != http.StatusBadRequest {
+		t.Errorf("changer un role sans etre administrateur: statut %d, attendu %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec := action("action", "ban", "user_id", strconv.Itoa(bobID), "reason", "triche"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("bannir: statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+	}
+	if _, _, err := a.stores.Sessions.Validate(bob.Value); err == nil {
+		t.Error("session du joueur banni encore valide")
+	}
+
+	users, err := a.stores.Admin.ListUsers("bob", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || !users[0].Banned || users[0].BanReason != "triche" {
+		t.Errorf("utilisateurs = %+v", users)
+	}
+
+	if rec := action("action", "unban", "user_id", strconv.Itoa(bobID)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("debannir: statut %d, attendu %d", rec.Code, http.StatusSeeOther)
+	}
+	if role, _ := a.stores.Admin.UserRole(bobID); role != auth.RoleUser {
+		t.Errorf("role = %q", role)
+	}
+}
+
+func TestProfileAndLandingHandlers(t *testing.T) {
+	a := newTestApp(t)
+	aliceID, _ := a.testUser(t, "Alice", auth.RoleUser)
+	_, bob := a.testUser(t, "Bob", auth.RoleUser)
+
+	created, err := a.stores.Rooms.Create("petitbac", aliceID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := a.stores.Rooms.Create("blindtest", aliceID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := auth.OptionalAuthMiddleware(a.stores.Sessions, a.profileHandler)
+	if rec := serve(profile, http.MethodGet, "/user/Alice", nil, bob); rec.Code != http.StatusOK {
+		t.Errorf("profil: statut %d, attendu %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(profile, http.MethodGet, "/user/Personne", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("profil inconnu: statut %d, attendu %d", rec.Code, http.StatusNotFound)
+	}
+
+	// Seule la salle publique est proposee, et pas a son hote
+	landing := auth.AuthMiddleware(a.stores.Sessions, a.landingPageHandler)
+	rec := serve(landing, http.MethodGet, "/", nil, bob)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("accueil: statut %d, attendu %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), created.Code) {
+		t.Error("salle publique absente des suggestions")
+	}
+	if strings.Contains(rec.Body.String(), private.Code) {
+		t.Error("salle privee proposee")
+	}
+
+	suggestions, err := a.stores.Ratings.SuggestRooms(aliceID, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 0 {
+		t.Errorf("suggestions pour l'hote = %+v", suggestions)
+	}
+}
+
+func TestWebsocketHandlerRequiresMembership(t *testing.T) {
+	a := newTestApp(t)
+	aliceID, alice := a.testUser(t, "Alice", auth.RoleUser)
+	_, bob := a.testUser(t, "Bob", auth.RoleUser)
+
+	created, err := a.stores.Rooms.Create("petitbac", aliceID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := auth.AuthMiddleware(a.stores.Sessions, a.websocketHandler)
+
+	if rec := serve(handler, http.MethodGet, "/ws?room="+created.Code, nil, bob); rec.Code != http.StatusForbidden {
+		t.Errorf("joueur hors de la salle: statut %d, attendu %d", rec.Code, http.StatusForbidden)
+	}
+	// Le membre passe la verification ; sans en-tetes WebSocket l'upgrade echoue ensuite
+	if rec := serve(handler, http.MethodGet, "/ws?room="+created.Code, nil, alice); rec.Code != http.StatusBadRequest {
+		t.Errorf("membre de la salle: statut %d, attendu %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,237 @@
+package rating
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+const DefaultRating = 1500
+const kFactor = 32.0
+
+type Rating struct {
+	UserID      int
+	GameType    string
+	Rating      int
+	GamesPlayed int
+	UpdatedAt   time.Time
+}
+
+type HistoryEntry struct {
+	RoomID       int
+	GameType     string
+	RatingBefore int
+	RatingAfter  int
+	CreatedAt    time.Time
+}
+
+type SuggestedRoom struct {
+	Code       string
+	GameType   string
+	NbPlayers  int
+	MaxPlayers int
+	AvgRating  int
+}
+
+type placement struct {
+	UserID int
+	Total  int
+	Rating float64
+}
+
+// Elo multijoueur : chaque joueur est compare a tous les autres de la salle,
+// le gain est la moyenne des duels (victoire 1, egalite 0.5, defaite 0)
+func computeDeltas(players []placement) []int {
+	deltas := make([]int, len(players))
+	if len(players) < 2 {
+		return deltas
+	}
+
+	for i, player := range players {
+		var sum float64
+		for j, opponent := range players {
+			if i == j {
+				continue
+			}
+
+			expected := 1 / (1 + math.Pow(10, (opponent.Rating-player.Rating)/400))
+			actual := 0.5
+			if player.Total > opponent.Total {
+				actual = 1
+			} else if player.Total < opponent.Total {
+				actual = 0
+			}
+
+			sum += actual - expected
+		}
+
+		deltas[i] = int(math.Round(kFactor * sum / float64(len(players)-1)))
+	}
+
+	return deltas
+}
+
+func UpdateRatings(db *sql.DB, roomID int, gameType string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var alreadyRated int
+	err = tx.QueryRow("SELECT COUNT(*) FROM rating_history WHERE room_id = ?", roomID).Scan(&alreadyRated)
+	if err != nil {
+		return err
+	}
+	if alreadyRated > 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT rp.user_id, COALESCE(SUM(s.score), 0), COALESCE(r.rating, ?)
+		FROM room_players rp
+		LEFT JOIN scores s ON s.room_id = rp.room_id AND s.user_id = rp.user_id
+		LEFT JOIN ratings r ON r.user_id = rp.user_id AND r.game_type = ?
+		WHERE rp.room_id = ?
+		GROUP BY rp.user_id, r.rating
+	`, DefaultRating, gameType, roomID)
+	if err != nil {
+		return err
+	}
+
+	var players []placement
+	for rows.Next() {
+		var player placement
+		if err := rows.Scan(&player.UserID, &player.Total, &player.Rating); err != nil {
+			rows.Close()
+			return err
+		}
+		players = append(players, player)
+	}
+	rows.Close()
+
+	if len(players) < 2 {
+		return nil
+	}
+
+	deltas := computeDeltas(players)
+	for i, player := range players {
+		before := int(player.Rating)
+		after := before + deltas[i]
+
+		_, err = tx.Exec(`
+			INSERT INTO ratings (user_id, game_type, rating, games_played, updated_at)
+			VALUES (?, ?, ?, 1, ?)
+			ON CONFLICT(user_id, game_type) DO UPDATE SET
+				rating = excluded.rating,
+				games_played = ratings.games_played + 1,
+				updated_at = excluded.updated_at
+		`, player.UserID, gameType, after, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO rating_history (user_id, game_type, room_id, rating_before, rating_after)
+			VALUES (?, ?, ?, ?, ?)
+		`, player.UserID, gameType, roomID, before, after)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func GetUserRatings(db *sql.DB, userID int) (map[string]Rating, error) {
+	ratings := map[string]Rating{
+		"blindtest": {UserID: userID, GameType: "blindtest", Rating: DefaultRating},
+		"petitbac":  {UserID: userID, GameType: "petitbac", Rating: DefaultRating},
+	}
+
+	rows, err := db.Query(`
+		SELECT game_type, rating, games_played, updated_at
+		FROM ratings
+		WHERE user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rating := Rating{UserID: userID}
+		err := rows.Scan(&rating.GameType, &rating.Rating, &rating.GamesPlayed, &rating.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ratings[rating.GameType] = rating
+	}
+
+	return ratings, nil
+}
+
+func GetRatingHistory(db *sql.DB, userID int, limit int) ([]HistoryEntry, error) {
+	rows, err := db.Query(`
+		SELECT room_id, game_type, rating_before, rating_after, created_at
+		FROM rating_history
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		err := rows.Scan(&entry.RoomID, &entry.GameType, &entry.RatingBefore, &entry.RatingAfter, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// Salles en attente dont le niveau moyen est le plus proche de celui du joueur
+func SuggestRooms(db *sql.DB, userID int, limit int) ([]SuggestedRoom, error) {
+	// Sous-requete : PostgreSQL n'accepte pas les alias dans une expression d'ORDER BY
+	rows, err := db.Query(`
+		SELECT code, game_type, nb_players, max_players, avg_rating, my_rating
+		FROM (
+			SELECT r.code, r.game_type, COUNT(rp.user_id) AS nb_players, r.max_players, r.created_at,
+				CAST(AVG(COALESCE(ra.rating, ?)) AS INTEGER) AS avg_rating,
+				COALESCE((SELECT rating FROM ratings WHERE user_id = ? AND game_type = r.game_type), ?) AS my_rating
+			FROM rooms r
+			JOIN room_players rp ON rp.room_id = r.id
+			LEFT JOIN ratings ra ON ra.user_id = rp.user_id AND ra.game_type = r.game_type
+			WHERE r.status = 'waiting' AND r.is_public = 1
+				AND r.id NOT IN (SELECT room_id FROM room_players WHERE user_id = ?)
+			GROUP BY r.id
+			HAVING COUNT(rp.user_id) < r.max_players
+		) suggestions
+		ORDER BY ABS(avg_rating - my_rating) ASC, created_at DESC
+		LIMIT ?
+	`, DefaultRating, userID, DefaultRating, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []SuggestedRoom
+	for rows.Next() {
+		var room SuggestedRoom
+		var myRating int
+		err := rows.Scan(&room.Code, &room.GameType, &room.NbPlayers, &room.MaxPlayers, &room.AvgRating, &myRating)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, room)
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,138 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Fichiers communs a toutes les pages : le squelette HTML ("base") et les
+// morceaux reutilises (logo, formulaire de deconnexion...)
+var sharedPatterns = []string{"layouts/*.html", "partials/*.html"}
+
+// Pages HTML parsees une fois au demarrage. Chaque page (fichier a la racine
+// de fsys) definit "title", "content" et au besoin "head", "body_attrs" ou
+// "scripts", inseres dans le layout "base".
+type Renderer struct {
+	fsys   fs.FS
+	funcs  template.FuncMap
+	reload bool
+
+	// Fonctions qui dependent de la requete (jeton CSRF). Elles remplacent a
+	// chaque rendu les fonctions de meme nom passees a New.
+	RequestFuncs func(r *http.Request) template.FuncMap
+
+	pages map[string]*template.Template
+}
+
+// Parse toutes les pages de fsys. Avec reload, elles sont relues a chaque
+// rendu pour voir les modifications sans redemarrer (developpement).
+func New(fsys fs.FS, funcs template.FuncMap, reload bool) (*Renderer, error) {
+	t := &Renderer{fsys: fsys, funcs: funcs, reload: reload}
+	pages, err := t.parseAll()
+	if err != nil {
+		return nil, err
+	}
+	t.pages = pages
+	return t, nil
+}
+
+func (t *Renderer) parseAll() (map[string]*template.Template, error) {
+	names, err := fs.Glob(t.fsys, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("aucun template trouve")
+	}
+
+	pages := make(map[string]*template.Template)
+	for _, name := range names {
+		page, err := t.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		pages[name] = page
+	}
+	return pages, nil
+}
+
+// La page est parsee apres le layout pour que ses "define" remplacent les blocs par defaut
+func (t *Renderer) parse(name string) (*template.Template, error) {
+	tmpl := template.New(path.Base(name)).Funcs(t.funcs)
+
+	for _, pattern := range sharedPatterns {
+		files, err := fs.Glob(t.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if tmpl, err = tmpl.ParseFS(t.fsys, files...); err != nil {
+			return nil, err
+		}
+	}
+
+	tmpl, err := tmpl.ParseFS(t.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Lookup("base") == nil {
+		return nil, fmt.Errorf("%s: layout \"base\" introuvable", name)
+	}
+	return tmpl, nil
+}
+
+func (t *Renderer) page(name string) (*template.Template, error) {
+	if t.reload {
+		return t.parse(name)
+	}
+
+	page, ok := t.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %s inconnu", name)
+	}
+	return page, nil
+}
+
+// Ecrit la page name. La page est d'abord rendue en memoire : en cas d'erreur
+// le visiteur recoit une 500 au lieu d'une page coupee au milieu.
+func (t *Renderer) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	html, err := t.execute(r, name, data)
+	if err != nil {
+		log.Printf("Erreur rendu %s: %v", name, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	html.WriteTo(w)
+}
+
+func (t *Renderer) execute(r *http.Request, name string, data interface{}) (*bytes.Buffer, error) {
+	page, err := t.page(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// html/template refuse de cloner un template deja execute : l'original
+	// partage n'est jamais execute, seulement ses copies
+	tmpl, err := page.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if t.RequestFuncs != nil {
+		tmpl.Funcs(t.RequestFuncs(r))
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base", data); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
@@ -0,0 +1,269 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"groupie-tracker/deezer"
+	"groupie-tracker/game"
+	"groupie-tracker/rating"
+	"groupie-tracker/scoreboard"
+)
+
+const pauseBetweenRounds = 5 * time.Second
+
+var errGameStopped = errors.New("partie interrompue")
+
+type BlindTestGame struct {
+	RoomID   int
+	hub      *Hub
+	config   game.BlindTestConfig
+	answers  chan blindTestAnswer
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+type blindTestAnswer struct {
+	UserID int
+	Pseudo string
+	Text   string
+}
+
+func StartBlindTest(hub *Hub, roomID int, hostID int) error {
+	// Avant l'appel a Deezer : un joueur qui n'est pas l'hote ne declenche aucune requete
+	if err := CanStartGame(hub.DB, roomID, hostID); err != nil {
+		return err
+	}
+
+	config, err := game.GetBlindTestConfig(hub.DB, roomID)
+	if err != nil {
+		config = &game.BlindTestConfig{
+			RoomID:       roomID,
+			Playlist:     game.DefaultPlaylist,
+			ResponseTime: game.DefaultResponseTime,
+			NbrRounds:    game.DefaultBlindTestRounds,
+		}
+	}
+
+	tracks, err := deezer.GetTracksByGenre(config.Playlist)
+	if err != nil {
+		return err
+	}
+
+	var playable []deezer.Track
+	for _, track := range tracks {
+		if track.Preview != "" {
+			playable = append(playable, track)
+		}
+	}
+	if len(playable) == 0 {
+		return errors.New("aucune musique trouvee")
+	}
+
+	g := &BlindTestGame{
+		RoomID:  roomID,
+		hub:     hub,
+		config:  *config,
+		answers: make(chan blindTestAnswer, 64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	hub.mu.Lock()
+	if hub.closing {
+		hub.mu.Unlock()
+		return ErrServerShuttingDown
+	}
+	if _, running := hub.Games[roomID]; running {
+		hub.mu.Unlock()
+		return ErrGameAlreadyStarted
+	}
+	hub.Games[roomID] = g
+	hub.mu.Unlock()
+
+	if err := StartGame(hub.DB, roomID, hostID); err != nil {
+		hub.removeGame(roomID)
+		close(g.done)
+		return err
+	}
+
+	rand.Shuffle(len(playable), func(i, j int) {
+		playable[i], playable[j] = playable[j], playable[i]
+	})
+
+	go g.run(playable)
+	return nil
+}
+
+func (g *BlindTestGame) SubmitAnswer(c *Client, text string) {
+	select {
+	case g.answers <- blindTestAnswer{UserID: c.UserID, Pseudo: c.Pseudo, Text: text}:
+	default:
+		log.Printf("Reponse ignoree pour la salle %d", g.RoomID)
+	}
+}
+
+// Arrete la partie en cours sans la terminer (ni classement Elo ni badges)
+func (g *BlindTestGame) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stop)
+	})
+}
+
+func (g *BlindTestGame) Done() <-chan struct{} {
+	return g.done
+}
+
+func (g *BlindTestGame) run(tracks []deezer.Track) {
+	defer close(g.done)
+	defer g.hub.removeGame(g.RoomID)
+
+	g.hub.SendToRoom(g.RoomID, "game_start", nil)
+
+	totalRounds := g.config.NbrRounds
+	if totalRounds > len(tracks) {
+		totalRounds = len(tracks)
+	}
+
+	for i := 0; i < totalRounds; i++ {
+		err := g.playRound(i+1, totalRounds, tracks[i])
+		if err == errGameStopped {
+			log.Printf("Partie de la salle %d interrompue", g.RoomID)
+			return
+		}
+		if err != nil {
+			log.Printf("Erreur manche %d salle %d: %v", i+1, g.RoomID, err)
+			break
+		}
+
+		if i < totalRounds-1 {
+			select {
+			case <-time.After(pauseBetweenRounds):
+			case <-g.stop:
+				log.Printf("Partie de la salle %d interrompue", g.RoomID)
+				return
+			}
+		}
+	}
+
+	if _, err := g.hub.DB.Exec("UPDATE rooms SET status = 'finished' WHERE id = ?", g.RoomID); err != nil {
+		log.Printf("Erreur fin de partie salle %d: %v", g.RoomID, err)
+	}
+
+	if err := rating.UpdateRatings(g.hub.DB, g.RoomID, "blindtest"); err != nil {
+		log.Printf("Erreur mise a jour classement Elo salle %d: %v", g.RoomID, err)
+	}
+
+	finalScoreboard, err := scoreboard.GetGameScoreboard(g.hub.DB, g.RoomID, "blindtest")
+	if err != nil {
+		log.Printf("Erreur scoreboard salle %d: %v", g.RoomID, err)
+	}
+
+	recap, err := game.GetBlindTestRecap(g.hub.DB, g.RoomID)
+	if err != nil {
+		log.Printf("Erreur recap salle %d: %v", g.RoomID, err)
+	}
+
+	g.hub.SendToRoom(g.RoomID, "game_end", map[string]interface{}{
+		"scoreboard": finalScoreboard,
+		"recap":      recap,
+	})
+
+	g.hub.CheckAchievements(g.RoomID, "game_end")
+}
+
+func (g *BlindTestGame) playRound(roundNumber int, totalRounds int, track deezer.Track) error {
+	// Les reponses envoyees pendant la pause ne comptent pas pour cette manche
+	for len(g.answers) > 0 {
+		<-g.answers
+	}
+
+	round, err := game.StartBlindTestRound(g.hub.DB, g.RoomID, roundNumber, track)
+	if err != nil {
+		return err
+	}
+
+	g.hub.SendToRoom(g.RoomID, "round_start", map[string]interface{}{
+		"roundNumber":  roundNumber,
+		"totalRounds":  totalRounds,
+		"preview":      track.Preview,
+		"responseTime": g.config.ResponseTime,
+	})
+
+	timer := time.NewTimer(time.Duration(g.config.ResponseTime) * time.Second)
+	defer timer.Stop()
+
+	found := make(map[int]bool)
+	position := 0
+
+roundLoop:
+	for {
+		select {
+		case answer := <-g.answers:
+			if found[answer.UserID] {
+				continue
+			}
+
+			guess := game.BlindTestGuess{
+				RoundID:      round.ID,
+				UserID:       answer.UserID,
+				RawText:      answer.Text,
+				MatchedField: game.MatchBlindTestAnswer(answer.Text, *round),
+				ElapsedMs:    time.Since(round.StartedAt).Milliseconds(),
+			}
+
+			if guess.MatchedField != "" {
+				position++
+				found[answer.UserID] = true
+				guess.Points = game.CalculateBlindTestPoints(position, g.hub.CountClients(g.RoomID))
+
+				if err := game.SaveBlindTestScore(g.hub.DB, g.RoomID, answer.UserID, roundNumber, guess.Points); err != nil {
+					log.Printf("Erreur sauvegarde score: %v", err)
+				}
+			}
+
+			if err := game.SaveBlindTestGuess(g.hub.DB, guess); err != nil {
+				log.Printf("Erreur sauvegarde reponse: %v", err)
+			}
+
+			g.hub.SendToRoom(g.RoomID, "answer_submitted", map[string]interface{}{
+				"pseudo": answer.Pseudo,
+				"found":  guess.MatchedField != "",
+				"points": guess.Points,
+			})
+
+			if len(found) >= g.hub.CountClients(g.RoomID) {
+				break roundLoop
+			}
+
+		case <-timer.C:
+			break roundLoop
+
+		case <-g.stop:
+			if err := game.EndBlindTestRound(g.hub.DB, round.ID); err != nil {
+				log.Printf("Erreur fin de manche salle %d: %v", g.RoomID, err)
+			}
+			return errGameStopped
+		}
+	}
+
+	if err := game.EndBlindTestRound(g.hub.DB, round.ID); err != nil {
+		return err
+	}
+
+	g.hub.SendToRoom(g.RoomID, "round_end", map[string]interface{}{
+		"roundNumber": roundNumber,
+		"title":       track.Title,
+		"artist":      track.Artist,
+		"cover":       track.Cover,
+	})
+
+	g.hub.SendScoreboard(g.RoomID, "blindtest", roundNumber)
+	g.hub.CheckAchievements(g.RoomID, "round_end")
+
+	return nil
+}
@@ -0,0 +1,363 @@
+package room
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"groupie-tracker/game"
+	"groupie-tracker/rating"
+	"groupie-tracker/scoreboard"
+)
+
+const (
+	petitBacDefaultResponseTime = 60
+	petitBacMinResponseTime     = 10
+	petitBacMaxResponseTime     = 300
+	petitBacVoteTime            = 30
+	petitBacMaxAnswerLength     = 60
+)
+
+// Partie de petit bac pilotee par le serveur : chaque manche enchaine une
+// phase de reponses puis une phase de correction ou les joueurs refusent les
+// reponses des autres. Les points sont calcules et enregistres ici.
+type PetitBacGame struct {
+	RoomID       int
+	hub          *Hub
+	categories   []string
+	responseTime int
+	nbrRounds    int
+	answers      chan petitBacSubmission
+	votes        chan petitBacBallot
+	stop         chan struct{}
+	stopOnce     sync.Once
+	done         chan struct{}
+}
+
+type petitBacSubmission struct {
+	UserID  int
+	Pseudo  string
+	Answers map[string]string
+}
+
+// Reponse designee par son auteur et sa categorie
+type petitBacAnswerKey struct {
+	UserID   int    `json:"user_id"`
+	Category string `json:"category"`
+}
+
+type petitBacBallot struct {
+	UserID   int
+	Rejected []petitBacAnswerKey
+}
+
+func StartPetitBac(hub *Hub, roomID int, hostID int, categories []string, responseTime int) error {
+	for i := range categories {
+		categories[i] = strings.TrimSpace(categories[i])
+	}
+	if err := game.ValidatePetitBacCategories(categories); err != nil {
+		return err
+	}
+
+	if responseTime < petitBacMinResponseTime || responseTime > petitBacMaxResponseTime {
+		responseTime = petitBacDefaultResponseTime
+	}
+
+	nbrRounds := game.DefaultPetitBacRounds
+	if config, err := game.GetPetitBacConfig(hub.DB, roomID); err == nil {
+		nbrRounds = config.NbrRounds
+	}
+
+	g := &PetitBacGame{
+		RoomID:       roomID,
+		hub:          hub,
+		categories:   categories,
+		responseTime: responseTime,
+		nbrRounds:    nbrRounds,
+		answers:      make(chan petitBacSubmission, 64),
+		votes:        make(chan petitBacBallot, 64),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	hub.mu.Lock()
+	if hub.closing {
+		hub.mu.Unlock()
+		return ErrServerShuttingDown
+	}
+	if _, running := hub.Games[roomID]; running {
+		hub.mu.Unlock()
+		return ErrGameAlreadyStarted
+	}
+	hub.Games[roomID] = g
+	hub.mu.Unlock()
+
+	if err := StartGame(hub.DB, roomID, hostID); err != nil {
+		hub.removeGame(roomID)
+		close(g.done)
+		return err
+	}
+
+	// Garde une trace des categories jouees ; la partie utilise sa propre copie
+	if err := game.SetPetitBacCategories(hub.DB, roomID, categories); err != nil {
+		log.Printf("Erreur sauvegarde categories salle %d: %v", roomID, err)
+	}
+	if _, err := game.GetPetitBacConfig(hub.DB, roomID); err != nil {
+		if err := game.CreatePetitBacConfig(hub.DB, roomID, responseTime, nbrRounds); err != nil {
+			log.Printf("Erreur sauvegarde configuration salle %d: %v", roomID, err)
+		}
+	}
+
+	go g.run()
+	return nil
+}
+
+func (g *PetitBacGame) SubmitAnswers(c *Client, answers map[string]string) {
+	select {
+	case g.answers <- petitBacSubmission{UserID: c.UserID, Pseudo: c.Pseudo, Answers: answers}:
+	default:
+		log.Printf("Reponses ignorees pour la salle %d", g.RoomID)
+	}
+}
+
+func (g *PetitBacGame) SubmitVotes(c *Client, rejected []petitBacAnswerKey) {
+	select {
+	case g.votes <- petitBacBallot{UserID: c.UserID, Rejected: rejected}:
+	default:
+		log.Printf("Votes ignores pour la salle %d", g.RoomID)
+	}
+}
+
+// Arrete la partie en cours sans la terminer (ni classement Elo ni badges)
+func (g *PetitBacGame) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stop)
+	})
+}
+
+func (g *PetitBacGame) Done() <-chan struct{} {
+	return g.done
+}
+
+func (g *PetitBacGame) run() {
+	defer close(g.done)
+	defer g.hub.removeGame(g.RoomID)
+
+	g.hub.SendToRoom(g.RoomID, "game_start", map[string]interface{}{
+		"categories":  g.categories,
+		"totalRounds": g.nbrRounds,
+	})
+
+	var usedLetters []string
+	for i := 0; i < g.nbrRounds; i++ {
+		letter := game.GenerateRandomLetter(usedLetters)
+		usedLetters = append(usedLetters, letter)
+
+		err := g.playRound(i+1, letter)
+		if err == errGameStopped {
+			log.Printf("Partie de la salle %d interrompue", g.RoomID)
+			return
+		}
+		if err != nil {
+			log.Printf("Erreur manche %d salle %d: %v", i+1, g.RoomID, err)
+			break
+		}
+
+		if i < g.nbrRounds-1 {
+			select {
+			case <-time.After(pauseBetweenRounds):
+			case <-g.stop:
+				log.Printf("Partie de la salle %d interrompue", g.RoomID)
+				return
+			}
+		}
+	}
+
+	if _, err := g.hub.DB.Exec("UPDATE rooms SET status = 'finished' WHERE id = ?", g.RoomID); err != nil {
+		log.Printf("Erreur fin de partie salle %d: %v", g.RoomID, err)
+	}
+
+	if err := rating.UpdateRatings(g.hub.DB, g.RoomID, "petitbac"); err != nil {
+		log.Printf("Erreur mise a jour classement Elo salle %d: %v", g.RoomID, err)
+	}
+
+	finalScoreboard, err := scoreboard.GetGameScoreboard(g.hub.DB, g.RoomID, "petitbac")
+	if err != nil {
+		log.Printf("Erreur scoreboard salle %d: %v", g.RoomID, err)
+	}
+
+	g.hub.SendToRoom(g.RoomID, "game_end", map[string]interface{}{
+		"scoreboard": finalScoreboard,
+	})
+
+	g.hub.CheckAchievements(g.RoomID, "game_end")
+}
+
+func (g *PetitBacGame) playRound(roundNumber int, letter string) error {
+	// Les envois arrives pendant la pause ne comptent pas pour cette manche
+	for len(g.answers) > 0 {
+		<-g.answers
+	}
+	for len(g.votes) > 0 {
+		<-g.votes
+	}
+
+	g.hub.SendToRoom(g.RoomID, "round_start", map[string]interface{}{
+		"roundNumber":  roundNumber,
+		"totalRounds":  g.nbrRounds,
+		"letter":       letter,
+		"categories":   g.categories,
+		"responseTime": g.responseTime,
+	})
+
+	submissions, err := g.collectAnswers()
+	if err != nil {
+		return err
+	}
+
+	var answers []game.PetitBacAnswer
+	for _, submission := range submissions {
+		for _, category := range g.categories {
+			text := strings.TrimSpace(submission.Answers[category])
+			if text == "" {
+				continue
+			}
+			if runes := []rune(text); len(runes) > petitBacMaxAnswerLength {
+				text = string(runes[:petitBacMaxAnswerLength])
+			}
+			answers = append(answers, game.PetitBacAnswer{
+				UserID:   submission.UserID,
+				Pseudo:   submission.Pseudo,
+				Category: category,
+				Text:     text,
+				Valid:    game.ValidateAnswer(text, letter),
+			})
+		}
+	}
+
+	// Sans adversaire il n'y a personne pour corriger
+	if len(submissions) > 1 && len(answers) > 0 {
+		g.hub.SendToRoom(g.RoomID, "round_answers", map[string]interface{}{
+			"roundNumber": roundNumber,
+			"letter":      letter,
+			"voteTime":    petitBacVoteTime,
+			"answers":     answers,
+		})
+
+		if err := g.collectVotes(submissions, answers); err != nil {
+			return err
+		}
+	}
+
+	voters := len(submissions) - 1
+	if voters < 0 {
+		voters = 0
+	}
+	game.ScorePetitBacRound(answers, letter, voters)
+
+	points := make(map[int]int)
+	for _, answer := range answers {
+		points[answer.UserID] += answer.Points
+	}
+	for userID, total := range points {
+		if total == 0 {
+			continue
+		}
+		if err := game.SavePetitBacScore(g.hub.DB, g.RoomID, userID, roundNumber, total); err != nil {
+			log.Printf("Erreur sauvegarde score: %v", err)
+		}
+	}
+
+	g.hub.SendToRoom(g.RoomID, "round_end", map[string]interface{}{
+		"roundNumber": roundNumber,
+		"letter":      letter,
+		"results":     answers,
+	})
+
+	g.hub.SendScoreboard(g.RoomID, "petitbac", roundNumber)
+	g.hub.CheckAchievements(g.RoomID, "round_end")
+
+	return nil
+}
+
+// Attend les reponses de chaque joueur connecte ou la fin du temps imparti.
+// Seul le premier envoi d'un joueur est retenu.
+func (g *PetitBacGame) collectAnswers() ([]petitBacSubmission, error) {
+	timer := time.NewTimer(time.Duration(g.responseTime) * time.Second)
+	defer timer.Stop()
+
+	var submissions []petitBacSubmission
+	submitted := make(map[int]bool)
+
+	for {
+		select {
+		case submission := <-g.answers:
+			if submitted[submission.UserID] {
+				continue
+			}
+			submitted[submission.UserID] = true
+			submissions = append(submissions, submission)
+
+			g.hub.SendToRoom(g.RoomID, "answers_submitted", map[string]interface{}{
+				"pseudo": submission.Pseudo,
+			})
+
+			if len(submissions) >= g.hub.CountClients(g.RoomID) {
+				return submissions, nil
+			}
+
+		case <-timer.C:
+			return submissions, nil
+
+		case <-g.stop:
+			return nil, errGameStopped
+		}
+	}
+}
+
+// Compte pour chaque reponse les joueurs qui l'ont refusee. Seuls les joueurs
+// ayant repondu a la manche votent, une fois, et jamais sur leurs reponses.
+func (g *PetitBacGame) collectVotes(submissions []petitBacSubmission, answers []game.PetitBacAnswer) error {
+	timer := time.NewTimer(petitBacVoteTime * time.Second)
+	defer timer.Stop()
+
+	players := make(map[int]bool)
+	for _, submission := range submissions {
+		players[submission.UserID] = true
+	}
+
+	index := make(map[petitBacAnswerKey]int)
+	for i, answer := range answers {
+		index[petitBacAnswerKey{UserID: answer.UserID, Category: answer.Category}] = i
+	}
+
+	voted := make(map[int]bool)
+	for len(voted) < len(players) {
+		select {
+		case ballot := <-g.votes:
+			if !players[ballot.UserID] || voted[ballot.UserID] {
+				continue
+			}
+			voted[ballot.UserID] = true
+
+			counted := make(map[petitBacAnswerKey]bool)
+			for _, key := range ballot.Rejected {
+				i, ok := index[key]
+				if !ok || key.UserID == ballot.UserID || counted[key] {
+					continue
+				}
+				counted[key] = true
+				answers[i].Rejections++
+			}
+
+		case <-timer.C:
+			return nil
+
+		case <-g.stop:
+			return errGameStopped
+		}
+	}
+
+	return nil
+}
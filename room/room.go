@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"time"
+
+	"groupie-tracker/database"
 )
 
 type Room struct {
@@ -14,6 +16,7 @@ type Room struct {
 	GameType   string
 	HostID     int
 	MaxPlayers int
+	IsPublic   bool
 	Status     string
 	CreatedAt  time.Time
 	Players    []Player
@@ -25,6 +28,23 @@ type Player struct {
 	JoinedAt time.Time
 }
 
+var (
+	ErrInvalidGameType    = errors.New("type de jeu invalide")
+	ErrRoomNotFound       = errors.New("salle introuvable")
+	ErrRoomFull           = errors.New("la salle est pleine")
+	ErrAlreadyJoined      = errors.New("vous etes deja dans cette salle")
+	ErrGameAlreadyStarted = errors.New("la partie a deja commence")
+	ErrNotHost            = errors.New("seul l'hote peut demarrer la partie")
+	ErrNoRoomCode         = errors.New("impossible de generer un code de salle libre")
+	ErrServerShuttingDown = errors.New("le serveur redemarre, reessayez dans un instant")
+)
+
+// Nombre de codes tires avant d'abandonner (16 millions de codes possibles)
+const roomCodeAttempts = 5
+
+// Places par salle, fixe au demarrage par la configuration (game.max_players)
+var MaxPlayers = 10
+
 func GenerateRoomCode() (string, error) {
 	bytes := make([]byte, 3)
 	if _, err := rand.Read(bytes); err != nil {
@@ -33,19 +53,60 @@ func GenerateRoomCode() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func CreateRoom(db *sql.DB, gameType string, hostID int) (*Room, error) {
+// Tire un code absent de la table rooms. Sous SQLite le verrou d'ecriture pris au
+// BEGIN (_txlock=immediate) exclut une creation concurrente ; sous PostgreSQL deux
+// creations peuvent tirer le meme code, la seconde bute alors sur l'index unique et
+// CreateRoom recommence avec un autre code.
+func generateUniqueRoomCode(tx *sql.Tx) (string, error) {
+	for i := 0; i < roomCodeAttempts; i++ {
+		code, err := GenerateRoomCode()
+		if err != nil {
+			return "", err
+		}
+
+		var taken bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM rooms WHERE code = ?)", code).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return code, nil
+		}
+	}
+	return "", ErrNoRoomCode
+}
+
+// La salle et son hote sont inseres ensemble : pas de salle sans joueur en cas d'erreur.
+// Une salle publique est proposee aux autres joueurs, une privee ne se rejoint que par son code.
+func CreateRoom(db *sql.DB, gameType string, hostID int, isPublic bool) (*Room, error) {
 	if gameType != "blindtest" && gameType != "petitbac" {
-		return nil, errors.New("type de jeu invalide")
+		return nil, ErrInvalidGameType
+	}
+
+	for i := 0; i < roomCodeAttempts; i++ {
+		room, err := insertRoom(db, gameType, hostID, isPublic)
+		if database.IsUniqueViolation(err) {
+			continue
+		}
+		return room, err
+	}
+	return nil, ErrNoRoomCode
+}
+
+func insertRoom(db *sql.DB, gameType string, hostID int, isPublic bool) (*Room, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	code, err := GenerateRoomCode()
+	code, err := generateUniqueRoomCode(tx)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := db.Exec(
-		"INSERT INTO rooms (code, game_type, host_id, status) VALUES (?, ?, ?, 'waiting')",
-		code, gameType, hostID,
+	result, err := tx.Exec(
+		"INSERT INTO rooms (code, game_type, host_id, max_players, is_public, status) VALUES (?, ?, ?, ?, ?, 'waiting')",
+		code, gameType, hostID, MaxPlayers, isPublic,
 	)
 	if err != nil {
 		return nil, err
@@ -56,7 +117,7 @@ func CreateRoom(db *sql.DB, gameType string, hostID int) (*Room, error) {
 		return nil, err
 	}
 
-	_, err = db.Exec(
+	_, err = tx.Exec(
 		"INSERT INTO room_players (room_id, user_id) VALUES (?, ?)",
 		roomID, hostID,
 	)
@@ -64,12 +125,17 @@ func CreateRoom(db *sql.DB, gameType string, hostID int) (*Room, error) {
 		return nil, err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	room := &Room{
 		ID:         int(roomID),
 		Code:       code,
 		GameType:   gameType,
 		HostID:     hostID,
-		MaxPlayers: 10,
+		MaxPlayers: MaxPlayers,
+		IsPublic:   isPublic,
 		Status:     "waiting",
 		CreatedAt:  time.Now(),
 	}
@@ -81,13 +147,16 @@ func GetRoomByCode(db *sql.DB, code string) (*Room, error) {
 	var room Room
 
 	err := db.QueryRow(`
-		SELECT id, code, game_type, host_id, max_players, status, created_at
+		SELECT id, code, game_type, host_id, max_players, is_public, status, created_at
 		FROM rooms
 		WHERE code = ?
-	`, code).Scan(&room.ID, &room.Code, &room.GameType, &room.HostID, &room.MaxPlayers, &room.Status, &room.CreatedAt)
+	`, code).Scan(&room.ID, &room.Code, &room.GameType, &room.HostID, &room.MaxPlayers, &room.IsPublic, &room.Status, &room.CreatedAt)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRoomNotFound
+	}
 	if err != nil {
-		return nil, errors.New("salle introuvable")
+		return nil, err
 	}
 
 	room.Players, err = GetRoomPlayers(db, room.ID)
@@ -98,30 +167,61 @@ func GetRoomByCode(db *sql.DB, code string) (*Room, error) {
 	return &room, nil
 }
 
+// Les verifications et l'insertion sont dans la meme transaction : deux arrivees
+// simultanees ne peuvent pas depasser max_players
 func JoinRoom(db *sql.DB, roomCode string, userID int) error {
-	room, err := GetRoomByCode(db, roomCode)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Verrouille la ligne de la salle : sous PostgreSQL deux arrivees simultanees
+	// compteraient sinon les memes places libres (SQLite verrouille deja au BEGIN)
+	if _, err := tx.Exec("UPDATE rooms SET max_players = max_players WHERE code = ?", roomCode); err != nil {
+		return err
+	}
+
+	var roomID, maxPlayers int
+	var status string
+	err = tx.QueryRow("SELECT id, max_players, status FROM rooms WHERE code = ?", roomCode).Scan(&roomID, &maxPlayers, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRoomNotFound
+	}
 	if err != nil {
 		return err
 	}
 
-	if len(room.Players) >= room.MaxPlayers {
-		return errors.New("la salle est pleine")
+	var alreadyJoined bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM room_players WHERE room_id = ? AND user_id = ?)", roomID, userID).Scan(&alreadyJoined)
+	if err != nil {
+		return err
+	}
+	if alreadyJoined {
+		return ErrAlreadyJoined
 	}
 
-	if room.Status != "waiting" {
-		return errors.New("la partie a deja commence")
+	if status != "waiting" {
+		return ErrGameAlreadyStarted
 	}
 
-	_, err = db.Exec(
+	var players int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM room_players WHERE room_id = ?", roomID).Scan(&players); err != nil {
+		return err
+	}
+	if players >= maxPlayers {
+		return ErrRoomFull
+	}
+
+	_, err = tx.Exec(
 		"INSERT INTO room_players (room_id, user_id) VALUES (?, ?)",
-		room.ID, userID,
+		roomID, userID,
 	)
-
 	if err != nil {
-		return errors.New("vous etes deja dans cette salle")
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func GetRoomPlayers(db *sql.DB, roomID int) ([]Player, error) {
@@ -151,6 +251,15 @@ func GetRoomPlayers(db *sql.DB, roomID int) ([]Player, error) {
 	return players, nil
 }
 
+func (r Room) HasPlayer(userID int) bool {
+	for _, player := range r.Players {
+		if player.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
 func IsRoomReady(r Room) bool {
 	if len(r.Players) < 2 {
 		return false
@@ -163,19 +272,45 @@ func IsRoomReady(r Room) bool {
 	return true
 }
 
+// Seul l'hote lance la partie, et une seule fois : la mise a jour conditionnelle
+// empeche de rejouer une salle deja en cours ou terminee
 func StartGame(db *sql.DB, roomID int, hostID int) error {
+	result, err := db.Exec(
+		"UPDATE rooms SET status = 'playing' WHERE id = ? AND host_id = ? AND status = 'waiting'",
+		roomID, hostID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err := CanStartGame(db, roomID, hostID); err != nil {
+			return err
+		}
+		return ErrGameAlreadyStarted
+	}
+	return nil
+}
+
+// Verifie sans rien modifier que hostID peut lancer la partie de la salle
+func CanStartGame(db *sql.DB, roomID int, hostID int) error {
 	var currentHostID int
-	err := db.QueryRow("SELECT host_id FROM rooms WHERE id = ?", roomID).Scan(&currentHostID)
+	var status string
+	err := db.QueryRow("SELECT host_id, status FROM rooms WHERE id = ?", roomID).Scan(&currentHostID, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRoomNotFound
+	}
 	if err != nil {
-		return errors.New("salle introuvable")
+		return err
 	}
 
 	if currentHostID != hostID {
-		return errors.New("seul l'hote peut demarrer la partie")
+		return ErrNotHost
 	}
-
-	_, err = db.Exec("UPDATE rooms SET status = 'playing' WHERE id = ?", roomID)
-	return err
+	if status != "waiting" {
+		return ErrGameAlreadyStarted
+	}
+	return nil
 }
 
 func LeaveRoom(db *sql.DB, roomID int, userID int) error {
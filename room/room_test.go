@@ -0,0 +1,70 @@
+package room
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"groupie-tracker/database"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.InitDB("sqlite", filepath.Join(t.TempDir(), "room.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createTestUser(t *testing.T, db *sql.DB, pseudo string) int {
+	t.Helper()
+	result, err := db.Exec(
+		"INSERT INTO users (pseudo, pseudo_key, email, password_hash) VALUES (?, ?, ?, '')",
+		pseudo, strings.ToLower(pseudo), fmt.Sprintf("%s@example.com", strings.ToLower(pseudo)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+// Une partie terminee ne peut pas etre relancee : ses scores seraient enregistres une seconde fois
+func TestStartGame(t *testing.T) {
+	db := openTestDB(t)
+	hostID := createTestUser(t, db, "Alice")
+	playerID := createTestUser(t, db, "Bob")
+
+	created, err := CreateRoom(db, "petitbac", hostID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := JoinRoom(db, created.Code, playerID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := StartGame(db, created.ID+1, hostID); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("salle inconnue: %v, attendu %v", err, ErrRoomNotFound)
+	}
+	if err := StartGame(db, created.ID, playerID); !errors.Is(err, ErrNotHost) {
+		t.Errorf("joueur: %v, attendu %v", err, ErrNotHost)
+	}
+	if err := StartGame(db, created.ID, hostID); err != nil {
+		t.Fatalf("hote: %v", err)
+	}
+	if err := StartGame(db, created.ID, hostID); !errors.Is(err, ErrGameAlreadyStarted) {
+		t.Errorf("partie en cours: %v, attendu %v", err, ErrGameAlreadyStarted)
+	}
+
+	if _, err := db.Exec("UPDATE rooms SET status = 'finished' WHERE id = ?", created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartGame(db, created.ID, hostID); !errors.Is(err, ErrGameAlreadyStarted) {
+		t.Errorf("partie terminee: %v, attendu %v", err, ErrGameAlreadyStarted)
+	}
+}
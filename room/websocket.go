@@ -1,19 +1,44 @@
 package room
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
+
+	"groupie-tracker/achievement"
+	"groupie-tracker/auth"
+	"groupie-tracker/scoreboard"
+
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
+// Limites des connexions WebSocket, fixees au demarrage par la configuration (websocket.*)
+var (
+	ReadBufferSize        = 1024
+	WriteBufferSize       = 1024
+	MaxMessageSize  int64 = 4096
+	SendQueueSize         = 256
+)
+
+// Refuse les connexions ouvertes depuis un autre site (Cross-Site WebSocket Hijacking)
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
-	},
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(originURL.Host, auth.RequestHost(r))
 }
 
 type Client struct {
@@ -24,12 +49,23 @@ type Client struct {
 	Send   chan []byte
 }
 
+// Partie en cours dans une salle, menee par une goroutine du serveur
+type Game interface {
+	// Arrete la partie sans la terminer ; Done est ferme une fois la goroutine sortie
+	Stop()
+	Done() <-chan struct{}
+}
+
 type Hub struct {
+	DB         *sql.DB
 	Rooms      map[int]map[int]*Client
+	Games      map[int]Game
 	Register   chan *Client
 	Unregister chan *Client
 	Broadcast  chan *BroadcastMessage
 	mu         sync.RWMutex
+	closing    bool
+	writers    sync.WaitGroup
 }
 
 type BroadcastMessage struct {
@@ -45,9 +81,11 @@ type Message struct {
 	Content interface{} `json:"content"`
 }
 
-func NewHub() *Hub {
+func NewHub(db *sql.DB) *Hub {
 	return &Hub{
+		DB:         db,
 		Rooms:      make(map[int]map[int]*Client),
+		Games:      make(map[int]Game),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Broadcast:  make(chan *BroadcastMessage),
@@ -59,9 +97,19 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.Register:
 			h.mu.Lock()
+			if h.closing {
+				close(client.Send)
+				h.mu.Unlock()
+				continue
+			}
 			if h.Rooms[client.RoomID] == nil {
 				h.Rooms[client.RoomID] = make(map[int]*Client)
 			}
+			// Reconnexion ou second onglet : l'ancienne connexion est fermee par son
+			// WritePump, sinon il attendrait indefiniment et bloquerait Shutdown
+			if previous := h.Rooms[client.RoomID][client.UserID]; previous != nil {
+				close(previous.Send)
+			}
 			h.Rooms[client.RoomID][client.UserID] = client
 			h.mu.Unlock()
 			log.Printf("Client %s (%d) connecte a la salle %d", client.Pseudo, client.UserID, client.RoomID)
@@ -69,7 +117,8 @@ func (h *Hub) Run() {
 		case client := <-h.Unregister:
 			h.mu.Lock()
 			if room, ok := h.Rooms[client.RoomID]; ok {
-				if _, ok := room[client.UserID]; ok {
+				// Apres une reconnexion la place est prise par la nouvelle connexion
+				if room[client.UserID] == client {
 					delete(room, client.UserID)
 					close(client.Send)
 					if len(room) == 0 {
@@ -81,7 +130,9 @@ func (h *Hub) Run() {
 			log.Printf("Client %s (%d) deconnecte de la salle %d", client.Pseudo, client.UserID, client.RoomID)
 
 		case message := <-h.Broadcast:
-			h.mu.RLock()
+			// Verrou exclusif : un client trop lent est retire de la salle pendant
+			// que SendToClient ou ActiveRooms pourraient la parcourir
+			h.mu.Lock()
 			if room, ok := h.Rooms[message.RoomID]; ok {
 				for userID, client := range room {
 					if message.Exclude != 0 && userID == message.Exclude {
@@ -95,11 +146,315 @@ func (h *Hub) Run() {
 					}
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
 		}
 	}
 }
 
+func (h *Hub) SendToRoom(roomID int, msgType string, content interface{}) {
+	encodedMsg, err := json.Marshal(Message{Type: msgType, Content: content})
+	if err != nil {
+		log.Printf("Erreur encodage message: %v", err)
+		return
+	}
+
+	h.Broadcast <- &BroadcastMessage{
+		RoomID:  roomID,
+		Message: encodedMsg,
+	}
+}
+
+func (h *Hub) SendScoreboard(roomID int, gameType string, roundNumber int) {
+	currentScoreboard, err := scoreboard.GetGameScoreboardAfterRound(h.DB, roomID, gameType, roundNumber)
+	if err != nil {
+		log.Printf("Erreur scoreboard salle %d: %v", roomID, err)
+		return
+	}
+
+	h.SendToRoom(roomID, "scoreboard_update", currentScoreboard)
+}
+
+func (h *Hub) CheckAchievements(roomID int, event string) {
+	players, err := GetRoomPlayers(h.DB, roomID)
+	if err != nil {
+		log.Printf("Erreur badges salle %d: %v", roomID, err)
+		return
+	}
+
+	for _, player := range players {
+		unlocked, err := achievement.Evaluate(h.DB, player.UserID, event)
+		if err != nil {
+			log.Printf("Erreur badges joueur %d: %v", player.UserID, err)
+			continue
+		}
+
+		for _, a := range unlocked {
+			h.SendToRoom(roomID, "achievement_unlocked", map[string]interface{}{
+				"user_id":     player.UserID,
+				"pseudo":      player.Pseudo,
+				"code":        a.Code,
+				"name":        a.Name,
+				"description": a.Description,
+				"icon":        a.Icon,
+			})
+		}
+	}
+}
+
+func (h *Hub) SendToClient(c *Client, msgType string, content interface{}) {
+	encodedMsg, err := json.Marshal(Message{Type: msgType, Content: content})
+	if err != nil {
+		log.Printf("Erreur encodage message: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.Rooms[c.RoomID][c.UserID] != c {
+		return
+	}
+
+	select {
+	case c.Send <- encodedMsg:
+	default:
+	}
+}
+
+func (h *Hub) CountClients(roomID int) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.Rooms[roomID])
+}
+
+func (h *Hub) GetGame(roomID int) Game {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.Games[roomID]
+}
+
+type ActiveRoom struct {
+	RoomID      int
+	Players     []string
+	GameRunning bool
+}
+
+// Salles ayant au moins un joueur connecte
+func (h *Hub) ActiveRooms() []ActiveRoom {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var rooms []ActiveRoom
+	for roomID, clients := range h.Rooms {
+		active := ActiveRoom{RoomID: roomID}
+		for _, client := range clients {
+			active.Players = append(active.Players, client.Pseudo)
+		}
+		_, active.GameRunning = h.Games[roomID]
+		rooms = append(rooms, active)
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].RoomID > rooms[j].RoomID
+	})
+	return rooms
+}
+
+// Ferme une salle de force : la partie en cours est arretee, les joueurs
+// sont prevenus puis deconnectes et la salle ne peut plus etre rejointe
+func (h *Hub) CloseRoom(roomID int, reason string) error {
+	if currentGame := h.GetGame(roomID); currentGame != nil {
+		currentGame.Stop()
+	}
+
+	if _, err := h.DB.Exec("UPDATE rooms SET status = 'closed' WHERE id = ?", roomID); err != nil {
+		return err
+	}
+
+	encodedMsg, err := json.Marshal(Message{Type: "room_closed", Content: reason})
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// WritePump envoie les messages en attente puis ferme la connexion quand Send est ferme
+	for userID, client := range h.Rooms[roomID] {
+		select {
+		case client.Send <- encodedMsg:
+		default:
+		}
+		close(client.Send)
+		delete(h.Rooms[roomID], userID)
+	}
+	delete(h.Rooms, roomID)
+
+	return nil
+}
+
+// Arret du serveur : les parties en cours sont stoppees (la manche commencee est
+// cloturee en base) et leurs salles passent en 'interrupted', puis chaque joueur
+// recoit server_shutdown. Rend la main quand les files d'envoi sont videes ou
+// quand ctx expire.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	var games []Game
+	for _, g := range h.Games {
+		games = append(games, g)
+	}
+	h.mu.Unlock()
+
+	for _, g := range games {
+		g.Stop()
+	}
+	for _, g := range games {
+		select {
+		case <-g.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// Couvre aussi les salles 'playing' dont la partie s'est arretee sur une erreur
+	result, err := h.DB.ExecContext(ctx, "UPDATE rooms SET status = 'interrupted' WHERE status = 'playing'")
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("%d partie(s) interrompue(s) par l'arret du serveur", n)
+	}
+
+	encodedMsg, err := json.Marshal(Message{Type: "server_shutdown", Content: "Le serveur redemarre, la partie est interrompue"})
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	for roomID, clients := range h.Rooms {
+		for _, client := range clients {
+			select {
+			case client.Send <- encodedMsg:
+			default:
+			}
+			close(client.Send)
+		}
+		delete(h.Rooms, roomID)
+	}
+	h.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) removeGame(roomID int) {
+	h.mu.Lock()
+	delete(h.Games, roomID)
+	h.mu.Unlock()
+}
+
+// Retourne true si le message a ete traite par le moteur de jeu
+// et ne doit pas etre renvoye tel quel aux autres joueurs
+func (c *Client) handleGameMessage(hub *Hub, msg Message) bool {
+	switch msg.Type {
+	case "game_start":
+		var gameType string
+		err := hub.DB.QueryRow("SELECT game_type FROM rooms WHERE id = ?", c.RoomID).Scan(&gameType)
+		if err != nil {
+			hub.SendToClient(c, "error", ErrRoomNotFound.Error())
+			return true
+		}
+
+		// Le moteur annonce lui-meme game_start une fois la partie lancee
+		switch gameType {
+		case "blindtest":
+			err = StartBlindTest(hub, c.RoomID, c.UserID)
+		case "petitbac":
+			var content struct {
+				Categories   []string `json:"categories"`
+				ResponseTime int      `json:"responseTime"`
+			}
+			decodeContent(msg.Content, &content)
+			err = StartPetitBac(hub, c.RoomID, c.UserID, content.Categories, content.ResponseTime)
+		default:
+			err = ErrInvalidGameType
+		}
+		if err != nil {
+			hub.SendToClient(c, "error", err.Error())
+		}
+		return true
+
+	case "answer_submitted":
+		currentGame, ok := hub.GetGame(c.RoomID).(*BlindTestGame)
+		if !ok {
+			return true
+		}
+
+		content, _ := msg.Content.(map[string]interface{})
+		answer, _ := content["answer"].(string)
+		currentGame.SubmitAnswer(c, answer)
+		return true
+
+	case "answers_submitted":
+		currentGame, ok := hub.GetGame(c.RoomID).(*PetitBacGame)
+		if !ok {
+			return true
+		}
+
+		var content struct {
+			Answers map[string]string `json:"answers"`
+		}
+		decodeContent(msg.Content, &content)
+		currentGame.SubmitAnswers(c, content.Answers)
+		return true
+
+	case "validation_vote":
+		currentGame, ok := hub.GetGame(c.RoomID).(*PetitBacGame)
+		if !ok {
+			return true
+		}
+
+		var content struct {
+			Rejected []petitBacAnswerKey `json:"rejected"`
+		}
+		decodeContent(msg.Content, &content)
+		currentGame.SubmitVotes(c, content.Rejected)
+		return true
+	}
+
+	return false
+}
+
+// Relit le contenu generique d'un message dans la structure attendue.
+// Un contenu mal forme laisse v a sa valeur zero.
+func decodeContent(content interface{}, v interface{}) {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		log.Printf("Contenu de message invalide: %v", err)
+	}
+}
+
+// Messages qu'un client peut envoyer aux autres joueurs. Les autres types
+// (round_start, scoreboard_update, room_closed...) ne viennent que du serveur :
+// relayes tels quels, ils permettraient a un joueur de les falsifier.
+var clientMessageTypes = map[string]bool{
+	"player_connected": true,
+	"chat":             true,
+}
+
 func (c *Client) ReadPump(hub *Hub) {
 	defer func() {
 		hub.Unregister <- c
@@ -124,6 +479,14 @@ func (c *Client) ReadPump(hub *Hub) {
 		msg.UserID = c.UserID
 		msg.From = c.Pseudo
 
+		if c.handleGameMessage(hub, msg) {
+			continue
+		}
+		if !clientMessageTypes[msg.Type] {
+			log.Printf("Message %q de %s ignore", msg.Type, c.Pseudo)
+			continue
+		}
+
 		encodedMsg, err := json.Marshal(msg)
 		if err != nil {
 			log.Printf("Erreur encodage message: %v", err)
@@ -157,22 +520,43 @@ func (c *Client) WritePump() {
 }
 
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, roomID int, userID int, pseudo string) {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  ReadBufferSize,
+		WriteBufferSize: WriteBufferSize,
+		CheckOrigin:     checkOrigin,
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Erreur upgrade WebSocket: %v", err)
 		return
 	}
+	// Un message plus gros ferme la connexion (ReadMessage renvoie une erreur)
+	conn.SetReadLimit(MaxMessageSize)
 
 	client := &Client{
 		Conn:   conn,
 		RoomID: roomID,
 		UserID: userID,
 		Pseudo: pseudo,
-		Send:   make(chan []byte, 256),
+		Send:   make(chan []byte, SendQueueSize),
 	}
 
+	// Compte l'ecrivain sous le verrou : Shutdown ne peut pas attendre avant de l'avoir vu
+	hub.mu.Lock()
+	if hub.closing {
+		hub.mu.Unlock()
+		conn.Close()
+		return
+	}
+	hub.writers.Add(1)
+	hub.mu.Unlock()
+
 	hub.Register <- client
 
-	go client.WritePump()
+	go func() {
+		defer hub.writers.Done()
+		client.WritePump()
+	}()
 	go client.ReadPump(hub)
 }
\ No newline at end of file
@@ -0,0 +1,57 @@
+package room
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Un joueur qui ouvre un second onglet remplace sa premiere connexion : celle-ci
+// doit etre fermee, sinon son WritePump reste compte et Shutdown attend le delai entier
+func TestHubReplacedClientDoesNotBlockShutdown(t *testing.T) {
+	hub := NewHub(openTestDB(t))
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWS(hub, w, r, 1, 42, "Alice")
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	first, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	// La seconde connexion doit arriver apres l'enregistrement de la premiere
+	for hub.CountClients(1) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := first.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNoStatusReceived) {
+		t.Fatalf("premiere connexion: %v, attendu sa fermeture par le serveur", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := second.ReadMessage()
+	if err != nil || !strings.Contains(string(message), "server_shutdown") {
+		t.Errorf("seconde connexion: %q, %v, attendu server_shutdown", message, err)
+	}
+}
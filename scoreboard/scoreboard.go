@@ -2,22 +2,34 @@ package scoreboard
 
 import (
 	"database/sql"
+	"sort"
 )
 
 type ScoreboardEntry struct {
-	Pseudo string
-	Score  int
+	UserID    int
+	Pseudo    string
+	Score     int
+	Rounds    map[int]int
+	Rank      int
+	DenseRank int
+	Delta     int
 }
 
+// Retourne tous les joueurs de la salle (meme ceux a zero point) tries par score,
+// avec le rang (1, 1, 3) et le rang dense (1, 1, 2) en cas d'egalite.
+// Delta correspond aux points gagnes lors de la derniere manche ayant des scores.
 func GetGameScoreboard(db *sql.DB, roomID int, gameType string) ([]ScoreboardEntry, error) {
+	return GetGameScoreboardAfterRound(db, roomID, gameType, 0)
+}
+
+// Comme GetGameScoreboard mais Delta correspond aux points de la manche roundNumber
+func GetGameScoreboardAfterRound(db *sql.DB, roomID int, gameType string, roundNumber int) ([]ScoreboardEntry, error) {
 	rows, err := db.Query(`
-		SELECT u.pseudo, SUM(s.score) as total_score
-		FROM scores s
-		JOIN users u ON s.user_id = u.id
-		WHERE s.room_id = ? AND s.game_type = ?
-		GROUP BY u.id, u.pseudo
-		ORDER BY total_score DESC
-	`, roomID, gameType)
+		SELECT u.id, u.pseudo
+		FROM users u
+		WHERE u.id IN (SELECT user_id FROM room_players WHERE room_id = ?)
+			OR u.id IN (SELECT user_id FROM scores WHERE room_id = ? AND game_type = ?)
+	`, roomID, roomID, gameType)
 
 	if err != nil {
 		return nil, err
@@ -25,45 +37,108 @@ func GetGameScoreboard(db *sql.DB, roomID int, gameType string) ([]ScoreboardEnt
 	defer rows.Close()
 
 	var scoreboard []ScoreboardEntry
+	indexByUser := make(map[int]int)
 	for rows.Next() {
-		var entry ScoreboardEntry
-		err := rows.Scan(&entry.Pseudo, &entry.Score)
+		entry := ScoreboardEntry{Rounds: make(map[int]int)}
+		err := rows.Scan(&entry.UserID, &entry.Pseudo)
 		if err != nil {
 			return nil, err
 		}
+		indexByUser[entry.UserID] = len(scoreboard)
 		scoreboard = append(scoreboard, entry)
 	}
+	rows.Close()
+
+	scoreRows, err := db.Query(`
+		SELECT user_id, COALESCE(round_number, 0), score
+		FROM scores
+		WHERE room_id = ? AND game_type = ?
+	`, roomID, gameType)
 
+	if err != nil {
+		return nil, err
+	}
+	defer scoreRows.Close()
+
+	lastRound := 0
+	for scoreRows.Next() {
+		var userID, roundNumber, score int
+		err := scoreRows.Scan(&userID, &roundNumber, &score)
+		if err != nil {
+			return nil, err
+		}
+
+		index, ok := indexByUser[userID]
+		if !ok {
+			continue
+		}
+
+		entry := &scoreboard[index]
+		entry.Rounds[roundNumber] += score
+		entry.Score += score
+
+		if roundNumber > lastRound {
+			lastRound = roundNumber
+		}
+	}
+
+	if roundNumber <= 0 {
+		roundNumber = lastRound
+	}
+
+	for i := range scoreboard {
+		scoreboard[i].Delta = scoreboard[i].Rounds[roundNumber]
+	}
+
+	rankEntries(scoreboard)
 	return scoreboard, nil
 }
 
 func GetRoundScoreboard(db *sql.DB, roomID int, gameType string, roundNumber int) ([]ScoreboardEntry, error) {
-	rows, err := db.Query(`
-		SELECT u.pseudo, s.score
-		FROM scores s
-		JOIN users u ON s.user_id = u.id
-		WHERE s.room_id = ? AND s.game_type = ? AND s.round_number = ?
-		ORDER BY s.score DESC
-	`, roomID, gameType, roundNumber)
-
+	fullScoreboard, err := GetGameScoreboard(db, roomID, gameType)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var scoreboard []ScoreboardEntry
-	for rows.Next() {
-		var entry ScoreboardEntry
-		err := rows.Scan(&entry.Pseudo, &entry.Score)
-		if err != nil {
-			return nil, err
+	scoreboard := make([]ScoreboardEntry, len(fullScoreboard))
+	for i, entry := range fullScoreboard {
+		scoreboard[i] = ScoreboardEntry{
+			UserID: entry.UserID,
+			Pseudo: entry.Pseudo,
+			Score:  entry.Rounds[roundNumber],
+			Rounds: map[int]int{roundNumber: entry.Rounds[roundNumber]},
+			Delta:  entry.Rounds[roundNumber],
 		}
-		scoreboard = append(scoreboard, entry)
 	}
 
+	rankEntries(scoreboard)
 	return scoreboard, nil
 }
 
+func rankEntries(scoreboard []ScoreboardEntry) {
+	sort.SliceStable(scoreboard, func(i, j int) bool {
+		if scoreboard[i].Score != scoreboard[j].Score {
+			return scoreboard[i].Score > scoreboard[j].Score
+		}
+		return scoreboard[i].Pseudo < scoreboard[j].Pseudo
+	})
+
+	for i := range scoreboard {
+		if i > 0 && scoreboard[i].Score == scoreboard[i-1].Score {
+			scoreboard[i].Rank = scoreboard[i-1].Rank
+			scoreboard[i].DenseRank = scoreboard[i-1].DenseRank
+			continue
+		}
+
+		scoreboard[i].Rank = i + 1
+		if i == 0 {
+			scoreboard[i].DenseRank = 1
+		} else {
+			scoreboard[i].DenseRank = scoreboard[i-1].DenseRank + 1
+		}
+	}
+}
+
 func GetPlayerTotalScore(db *sql.DB, roomID int, userID int) (int, error) {
 	var totalScore int
 
@@ -74,4 +149,4 @@ func GetPlayerTotalScore(db *sql.DB, roomID int, userID int) (int, error) {
 	`, roomID, userID).Scan(&totalScore)
 
 	return totalScore, err
-}
\ No newline at end of file
+}
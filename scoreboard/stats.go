@@ -0,0 +1,209 @@
+package scoreboard
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type GameTypeStats struct {
+	GameType    string
+	GamesPlayed int
+	GamesWon    int
+	TotalPoints int
+}
+
+type PlayerStats struct {
+	UserID            int
+	Pseudo            string
+	TotalPoints       int
+	ByGameType        map[string]*GameTypeStats
+	AvgReactionMs     int64
+	BestPetitBacRound int
+	CurrentWinStreak  int
+	BestWinStreak     int
+}
+
+type LeaderboardEntry struct {
+	UserID      int
+	Pseudo      string
+	TotalPoints int
+	GamesPlayed int
+}
+
+// Periodes acceptees par GetLeaderboard (nombre de jours, 0 = depuis toujours)
+var LeaderboardPeriods = map[string]int{
+	"all": 0,
+	"7":   7,
+	"30":  30,
+}
+
+func GetPlayerStats(db *sql.DB, pseudo string) (*PlayerStats, error) {
+	stats := &PlayerStats{
+		ByGameType: map[string]*GameTypeStats{
+			"blindtest": {GameType: "blindtest"},
+			"petitbac":  {GameType: "petitbac"},
+		},
+	}
+
+	err := db.QueryRow("SELECT id, pseudo FROM users WHERE pseudo = ? AND deleted_at IS NULL AND is_guest = 0", pseudo).Scan(&stats.UserID, &stats.Pseudo)
+	if err != nil {
+		return nil, errors.New("joueur introuvable")
+	}
+
+	rows, err := db.Query(`
+		SELECT game_type, COALESCE(SUM(score), 0)
+		FROM scores
+		WHERE user_id = ?
+		GROUP BY game_type
+	`, stats.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gameType string
+		var points int
+		if err := rows.Scan(&gameType, &points); err != nil {
+			return nil, err
+		}
+		if stats.ByGameType[gameType] == nil {
+			stats.ByGameType[gameType] = &GameTypeStats{GameType: gameType}
+		}
+		stats.ByGameType[gameType].TotalPoints = points
+		stats.TotalPoints += points
+	}
+
+	results, err := getFinishedGames(db, stats.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Les parties sont triees de la plus ancienne a la plus recente
+	streak := 0
+	for _, result := range results {
+		if stats.ByGameType[result.GameType] == nil {
+			stats.ByGameType[result.GameType] = &GameTypeStats{GameType: result.GameType}
+		}
+		stats.ByGameType[result.GameType].GamesPlayed++
+
+		if result.Won {
+			stats.ByGameType[result.GameType].GamesWon++
+			streak++
+			if streak > stats.BestWinStreak {
+				stats.BestWinStreak = streak
+			}
+		} else {
+			streak = 0
+		}
+	}
+	stats.CurrentWinStreak = streak
+
+	err = db.QueryRow(`
+		SELECT CAST(COALESCE(AVG(g.elapsed_ms), 0) AS INTEGER)
+		FROM blindtest_guesses g
+		WHERE g.user_id = ? AND g.points > 0
+	`, stats.UserID).Scan(&stats.AvgReactionMs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COALESCE(MAX(score), 0)
+		FROM scores
+		WHERE user_id = ? AND game_type = 'petitbac'
+	`, stats.UserID).Scan(&stats.BestPetitBacRound)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+type gameResult struct {
+	RoomID   int
+	GameType string
+	Won      bool
+}
+
+// Une partie est gagnee si le joueur a le total le plus haut de la salle (egalite comprise)
+func getFinishedGames(db *sql.DB, userID int) ([]gameResult, error) {
+	rows, err := db.Query(`
+		WITH totals AS (
+			SELECT rp.room_id, rp.user_id, COALESCE(SUM(s.score), 0) AS total
+			FROM room_players rp
+			LEFT JOIN scores s ON s.room_id = rp.room_id AND s.user_id = rp.user_id
+			GROUP BY rp.room_id, rp.user_id
+		)
+		SELECT r.id, r.game_type,
+			t.total > 0 AND t.total >= (SELECT MAX(total) FROM totals WHERE room_id = r.id)
+		FROM rooms r
+		JOIN totals t ON t.room_id = r.id AND t.user_id = ?
+		WHERE r.status = 'finished'
+		ORDER BY r.created_at ASC, r.id ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []gameResult
+	for rows.Next() {
+		var result gameResult
+		if err := rows.Scan(&result.RoomID, &result.GameType, &result.Won); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func GetLeaderboard(db *sql.DB, days int, limit int) ([]LeaderboardEntry, error) {
+	since := time.Now().UTC().AddDate(-100, 0, 0)
+	if days > 0 {
+		since = time.Now().UTC().AddDate(0, 0, -days)
+	}
+
+	// Les parties jouees se comptent dans room_players : une partie terminee
+	// sans aucun point compte aussi
+	rows, err := db.Query(`
+		SELECT u.id, u.pseudo, COALESCE(p.total, 0) AS total_score, COALESCE(g.games, 0)
+		FROM users u
+		LEFT JOIN (
+			SELECT user_id, SUM(score) AS total
+			FROM scores
+			WHERE created_at >= ?
+			GROUP BY user_id
+		) p ON p.user_id = u.id
+		LEFT JOIN (
+			SELECT rp.user_id, COUNT(*) AS games
+			FROM room_players rp
+			JOIN rooms r ON rp.room_id = r.id
+			WHERE r.status = 'finished' AND r.created_at >= ?
+			GROUP BY rp.user_id
+		) g ON g.user_id = u.id
+		WHERE u.deleted_at IS NULL AND u.is_guest = 0
+			AND (p.user_id IS NOT NULL OR g.user_id IS NOT NULL)
+		ORDER BY total_score DESC
+		LIMIT ?
+	`, since, since, limit)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaderboard []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		err := rows.Scan(&entry.UserID, &entry.Pseudo, &entry.TotalPoints, &entry.GamesPlayed)
+		if err != nil {
+			return nil, err
+		}
+		leaderboard = append(leaderboard, entry)
+	}
+
+	return leaderboard, nil
+}
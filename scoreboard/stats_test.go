@@ -0,0 +1,69 @@
+package scoreboard_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"groupie-tracker/database"
+	"groupie-tracker/game"
+	"groupie-tracker/room"
+	"groupie-tracker/scoreboard"
+)
+
+// Une partie terminee compte dans GamesPlayed meme si le joueur n'y a marque aucun point
+func TestLeaderboardCountsGamesWithoutPoints(t *testing.T) {
+	db, err := database.InitDB("sqlite", filepath.Join(t.TempDir(), "scoreboard.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	userIDs := make(map[string]int)
+	for _, pseudo := range []string{"Alice", "Bob"} {
+		result, err := db.Exec(
+			"INSERT INTO users (pseudo, pseudo_key, email, password_hash) VALUES (?, ?, ?, '')",
+			pseudo, strings.ToLower(pseudo), strings.ToLower(pseudo)+"@example.com",
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		userIDs[pseudo] = int(id)
+	}
+
+	// Deux parties terminees avec Alice et Bob, ou seule Alice marque, et une en attente
+	for i := 0; i < 2; i++ {
+		created, err := room.CreateRoom(db, "petitbac", userIDs["Alice"], true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := room.JoinRoom(db, created.Code, userIDs["Bob"]); err != nil {
+			t.Fatal(err)
+		}
+		if err := game.SavePetitBacScore(db, created.ID, userIDs["Alice"], 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE rooms SET status = 'finished' WHERE id = ?", created.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := room.CreateRoom(db, "petitbac", userIDs["Alice"], true); err != nil {
+		t.Fatal(err)
+	}
+
+	leaderboard, err := scoreboard.GetLeaderboard(db, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][2]int{"Alice": {4, 2}, "Bob": {0, 2}}
+	if len(leaderboard) != len(want) {
+		t.Fatalf("classement = %+v", leaderboard)
+	}
+	for _, entry := range leaderboard {
+		if got := [2]int{entry.TotalPoints, entry.GamesPlayed}; got != want[entry.Pseudo] {
+			t.Errorf("%s: %d points en %d parties, attendu %v", entry.Pseudo, got[0], got[1], want[entry.Pseudo])
+		}
+	}
+}
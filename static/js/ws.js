@@ -104,6 +104,12 @@ class GameWebSocket {
             case 'answer_submitted':
                 this.onAnswerSubmitted(from, content);
                 break;
+            case 'answers_submitted':
+                this.onAnswersSubmitted(content);
+                break;
+            case 'round_answers':
+                this.onRoundAnswers(content);
+                break;
             case 'round_end':
                 this.onRoundEnd(content);
                 break;
@@ -113,11 +119,17 @@ class GameWebSocket {
             case 'scoreboard_update':
                 this.onScoreboardUpdate(content);
                 break;
-            case 'category_added':
-                this.onCategoryAdded(content);
+            case 'achievement_unlocked':
+                this.onAchievementUnlocked(content);
+                break;
+            case 'error':
+                this.onError(content);
                 break;
-            case 'category_deleted':
-                this.onCategoryDeleted(content);
+            case 'room_closed':
+                this.onRoomClosed(content);
+                break;
+            case 'server_shutdown':
+                this.onServerShutdown(content);
                 break;
         }
     }
@@ -165,23 +177,79 @@ class GameWebSocket {
             if (letterDisplay) letterDisplay.textContent = `Lettre : ${content.letter}`;
             if (gameLetter) gameLetter.textContent = content.letter;
         }
+
+        if (content.categories) {
+            this.hideWaitingRoom();
+            this.showGameInterface();
+            this.showPetitBacAnswerForm(content.categories);
+        }
+
+        if (content.preview) {
+            this.hideWaitingRoom();
+            this.showGameInterface();
+
+            const results = document.getElementById('round-results');
+            if (results) results.style.display = 'none';
+
+            const audioPlayer = document.getElementById('audio-player');
+            if (audioPlayer) {
+                audioPlayer.src = content.preview;
+                audioPlayer.play().catch(error => console.warn('Lecture audio bloquee:', error));
+            }
+        }
     }
 
     onAnswerSubmitted(from, content) {
-        console.log(`${from} a repondu`);
-        this.showPlayerAnswered(from);
+        const pseudo = (content && content.pseudo) || from;
+        console.log(`${pseudo} a repondu`);
+
+        if (content && content.found) {
+            this.showPlayerAnswered(pseudo);
+            this.addNotification(`${pseudo} a trouve ! (+${content.points} pts)`, 'success');
+        }
+    }
+
+    onAnswersSubmitted(content) {
+        console.log(`${content.pseudo} a termine`);
+        this.showPlayerAnswered(content.pseudo);
+        this.addNotification(`${content.pseudo} a termine !`, 'info');
+    }
+
+    onRoundAnswers(content) {
+        console.log('Correction des reponses');
+        this.addNotification(`Correction : ${content.voteTime} secondes pour refuser les mauvaises reponses`, 'info');
+        this.showPetitBacAnswers(content.answers, true);
     }
 
     onRoundEnd(content) {
         console.log('Fin du tour');
         this.addNotification('Fin du tour !', 'info');
+
+        if (content.results) {
+            this.showPetitBacAnswers(content.results, false);
+            return;
+        }
         this.showRoundResults(content);
     }
 
     onGameEnd(content) {
         console.log('Fin de la partie');
         this.addNotification('Partie terminee !', 'success');
-        this.showFinalScoreboard(content.scoreboard);
+        this.showFinalScoreboard(content.scoreboard || []);
+
+        if (content.recap) {
+            const audioPlayer = document.getElementById('audio-player');
+            if (audioPlayer) audioPlayer.pause();
+
+            const finalScoreboard = document.getElementById('final-scoreboard');
+            if (finalScoreboard) {
+                const recapLink = document.createElement('a');
+                recapLink.href = `/room/${this.roomCode}/recap`;
+                recapLink.className = 'btn-disconnect';
+                recapLink.textContent = 'Voir le recap de la partie';
+                finalScoreboard.appendChild(recapLink);
+            }
+        }
     }
 
     onScoreboardUpdate(content) {
@@ -189,13 +257,42 @@ class GameWebSocket {
         this.updateScoreboard(content);
     }
 
-    onCategoryAdded(content) {
-        console.log('Categorie ajoutee:', content.category);
-        this.addCategoryTag(content.category);
+    onAchievementUnlocked(content) {
+        console.log('Badge debloque:', content);
+        this.addNotification(`${content.icon} ${content.pseudo} debloque "${content.name}" !`, 'success');
+
+        const playerElement = document.querySelector(`[data-player="${CSS.escape(content.pseudo)}"]`);
+        if (playerElement) {
+            const badge = document.createElement('span');
+            badge.className = 'badge';
+            badge.title = `${content.name} : ${content.description}`;
+            badge.textContent = ` ${content.icon}`;
+            playerElement.appendChild(badge);
+        }
+    }
+
+    onError(content) {
+        console.error('Erreur serveur:', content);
+        this.addNotification(content, 'error');
+
+        const startButton = document.getElementById('start-game-btn');
+        if (startButton) startButton.disabled = false;
     }
 
-    onCategoryDeleted(content) {
-        console.log('Categorie supprimee:', content.category);
+    onRoomClosed(reason) {
+        // La salle n'existe plus : inutile de tenter de se reconnecter
+        this.maxReconnectAttempts = 0;
+        this.addNotification(reason, 'error');
+
+        setTimeout(() => {
+            window.location.href = '/';
+        }, 3000);
+    }
+
+    onServerShutdown(reason) {
+        // La partie est marquee interrompue : une reconnexion serait refusee
+        this.maxReconnectAttempts = 0;
+        this.addNotification(reason, 'warning');
     }
 
     addNotification(message, type) {
@@ -219,9 +316,13 @@ class GameWebSocket {
         const chatContainer = document.getElementById('chat-messages');
         if (!chatContainer) return;
 
+        // Texte des joueurs : jamais interprete comme du HTML
         const messageDiv = document.createElement('div');
         messageDiv.className = 'chat-message';
-        messageDiv.innerHTML = `<strong>${from}:</strong> ${content}`;
+        const author = document.createElement('strong');
+        author.textContent = `${from}:`;
+        messageDiv.appendChild(author);
+        messageDiv.appendChild(document.createTextNode(` ${content}`));
         chatContainer.appendChild(messageDiv);
 
         chatContainer.scrollTop = chatContainer.scrollHeight;
@@ -242,76 +343,185 @@ class GameWebSocket {
     }
 
     showPlayerAnswered(pseudo) {
-        const playerElement = document.querySelector(`[data-player="${pseudo}"]`);
+        const playerElement = document.querySelector(`[data-player="${CSS.escape(pseudo)}"]`);
         if (playerElement) {
             playerElement.classList.add('answered');
         }
     }
 
+    showPetitBacAnswerForm(categories) {
+        const form = document.getElementById('petitbac-answer-form');
+        const fields = document.getElementById('answer-fields');
+        if (!form || !fields) return;
+
+        document.querySelectorAll('.players-list .answered').forEach(player => player.classList.remove('answered'));
+
+        fields.replaceChildren(...categories.map(category => {
+            const item = document.createElement('div');
+            item.className = 'category-item';
+            const label = document.createElement('label');
+            label.textContent = category;
+            const input = document.createElement('input');
+            input.type = 'text';
+            input.maxLength = 60;
+            input.dataset.category = category;
+            item.append(label, input);
+            return item;
+        }));
+
+        form.querySelector('button').disabled = false;
+        form.style.display = 'block';
+
+        const validationPhase = document.getElementById('validation-phase');
+        if (validationPhase) validationPhase.style.display = 'none';
+    }
+
+    // Reponses groupees par categorie. En correction (voting), chaque reponse
+    // d'un autre joueur peut etre refusee ; sinon les points sont affiches.
+    showPetitBacAnswers(answers, voting) {
+        const validationPhase = document.getElementById('validation-phase');
+        const grid = document.getElementById('validation-grid');
+        if (!validationPhase || !grid) return;
+
+        const form = document.getElementById('petitbac-answer-form');
+        if (form) form.style.display = 'none';
+
+        const myId = Number(document.body.dataset.userId);
+        const byCategory = new Map();
+        answers.forEach(answer => {
+            if (!byCategory.has(answer.category)) byCategory.set(answer.category, []);
+            byCategory.get(answer.category).push(answer);
+        });
+
+        grid.replaceChildren(...Array.from(byCategory, ([category, categoryAnswers]) => {
+            const item = document.createElement('div');
+            item.className = 'validation-item';
+            const title = document.createElement('h4');
+            title.textContent = category;
+            item.appendChild(title);
+
+            categoryAnswers.forEach(answer => {
+                const row = document.createElement('div');
+                row.className = 'validation-answer';
+                row.dataset.userId = answer.user_id;
+                row.dataset.category = answer.category;
+                if (!answer.valid) row.classList.add('rejected');
+                row.appendChild(createSpan('pseudo', answer.pseudo));
+                row.appendChild(createSpan('answer', answer.answer));
+
+                if (!voting) {
+                    row.appendChild(createSpan('points', `+${answer.points}`));
+                } else if (answer.user_id !== myId) {
+                    const buttons = document.createElement('div');
+                    buttons.className = 'validation-buttons';
+                    const accept = document.createElement('button');
+                    accept.type = 'button';
+                    accept.className = 'btn-valid';
+                    accept.textContent = '✓';
+                    accept.addEventListener('click', () => row.classList.remove('rejected'));
+                    const reject = document.createElement('button');
+                    reject.type = 'button';
+                    reject.className = 'btn-invalid';
+                    reject.textContent = '✗';
+                    reject.addEventListener('click', () => row.classList.add('rejected'));
+                    buttons.append(accept, reject);
+                    row.appendChild(buttons);
+                }
+                item.appendChild(row);
+            });
+            return item;
+        }));
+
+        const finishButton = document.getElementById('finish-validation');
+        if (finishButton) {
+            finishButton.disabled = false;
+            finishButton.style.display = voting ? 'block' : 'none';
+        }
+        validationPhase.style.display = 'block';
+    }
+
     showRoundResults(results) {
         const resultsContainer = document.getElementById('round-results');
-        if (resultsContainer) {
-            resultsContainer.innerHTML = JSON.stringify(results, null, 2);
-            resultsContainer.style.display = 'block';
+        if (!resultsContainer) return;
+
+        if (results.title) {
+            resultsContainer.innerHTML = '';
+
+            if (results.cover) {
+                const cover = document.createElement('img');
+                cover.src = results.cover;
+                cover.className = 'recap-cover';
+                resultsContainer.appendChild(cover);
+            }
+
+            const track = document.createElement('div');
+            track.className = 'recap-track';
+            track.innerHTML = '<strong></strong><span></span>';
+            track.querySelector('strong').textContent = results.title;
+            track.querySelector('span').textContent = results.artist;
+            resultsContainer.appendChild(track);
+
+            resultsContainer.style.display = 'flex';
+            return;
         }
+
+        resultsContainer.textContent = JSON.stringify(results, null, 2);
+        resultsContainer.style.display = 'block';
     }
 
     updateScoreboard(scoreboardData) {
         const scoreboardElement = document.getElementById('scoreboard');
         if (!scoreboardElement) return;
 
-        let html = '<h3>Scores</h3><div class="scoreboard-list">';
-        
+        const title = document.createElement('h3');
+        title.textContent = 'Scores';
+        const list = document.createElement('div');
+        list.className = 'scoreboard-list';
+
         scoreboardData.forEach((entry, index) => {
-            html += `
-                <div class="scoreboard-entry">
-                    <span class="rank">${index + 1}.</span>
-                    <span class="pseudo">${entry.Pseudo}</span>
-                    <span class="score">${entry.Score} pts</span>
-                </div>
-            `;
+            const rank = entry.Rank || index + 1;
+            const row = document.createElement('div');
+            row.className = 'scoreboard-entry';
+            row.appendChild(createSpan('rank', `${rank}.`));
+            row.appendChild(createSpan('pseudo', entry.Pseudo));
+
+            const score = createSpan('score', `${entry.Score} pts`);
+            if (entry.Delta) {
+                score.appendChild(document.createTextNode(' '));
+                score.appendChild(createSpan('delta', `(+${entry.Delta})`));
+            }
+            row.appendChild(score);
+            list.appendChild(row);
         });
 
-        html += '</div>';
-        scoreboardElement.innerHTML = html;
+        scoreboardElement.replaceChildren(title, list);
     }
 
     showFinalScoreboard(scoreboardData) {
         const finalScoreboard = document.getElementById('final-scoreboard');
         if (!finalScoreboard) return;
 
-        let html = '<h2>Scoreboard Final</h2><div class="final-scoreboard-list">';
+        const title = document.createElement('h2');
+        title.textContent = 'Scoreboard Final';
+        const list = document.createElement('div');
+        list.className = 'final-scoreboard-list';
 
         scoreboardData.forEach((entry, index) => {
-            const medal = index === 0 ? '🥇' : index === 1 ? '🥈' : index === 2 ? '🥉' : '';
-            html += `
-                <div class="final-entry rank-${index + 1}">
-                    <span class="medal">${medal}</span>
-                    <span class="rank">${index + 1}.</span>
-                    <span class="pseudo">${entry.Pseudo}</span>
-                    <span class="score">${entry.Score} points</span>
-                </div>
-            `;
+            const rank = Number(entry.Rank) || index + 1;
+            const medal = rank === 1 ? '🥇' : rank === 2 ? '🥈' : rank === 3 ? '🥉' : '';
+            const row = document.createElement('div');
+            row.className = `final-entry rank-${rank}`;
+            row.appendChild(createSpan('medal', medal));
+            row.appendChild(createSpan('rank', `${rank}.`));
+            row.appendChild(createSpan('pseudo', entry.Pseudo));
+            row.appendChild(createSpan('score', `${entry.Score} points`));
+            list.appendChild(row);
         });
 
-        html += '</div>';
-        finalScoreboard.innerHTML = html;
+        finalScoreboard.replaceChildren(title, list);
         finalScoreboard.style.display = 'block';
     }
 
-    addCategoryTag(categoryName) {
-        const customCategoriesDiv = document.getElementById('custom-categories');
-        if (!customCategoriesDiv) return;
-
-        const tag = document.createElement('span');
-        tag.className = 'category-tag';
-        tag.innerHTML = `
-            ${categoryName}
-            <button type="button" onclick="removeCategory('${categoryName}')">×</button>
-        `;
-        customCategoriesDiv.appendChild(tag);
-    }
-
     disconnect() {
         if (this.ws) {
             this.ws.close();
@@ -320,6 +530,13 @@ class GameWebSocket {
     }
 }
 
+function createSpan(className, text) {
+    const span = document.createElement('span');
+    span.className = className;
+    span.textContent = text;
+    return span;
+}
+
 function submitBlindTestAnswer(gameWs, answer) {
     gameWs.send('answer_submitted', {
         answer: answer,
@@ -334,47 +551,20 @@ function submitPetitBacAnswers(gameWs, answers) {
     });
 }
 
-function votePetitBacAnswer(gameWs, category, answer, isValid) {
+function submitPetitBacVotes(gameWs, rejected) {
     gameWs.send('validation_vote', {
-        category: category,
-        answer: answer,
-        isValid: isValid
+        rejected: rejected
     });
 }
 
-function startGame(gameWs) {
-    gameWs.send('game_start', {
-        message: 'L\'hote a demarre la partie'
-    });
+function startGame(gameWs, settings) {
+    gameWs.send('game_start', settings || {});
 }
 
 function sendChatMessage(gameWs, message) {
     gameWs.send('chat', message);
 }
 
-function addCategory(categoryName) {
-    if (!categoryName || !gameWebSocket) return;
-
-    gameWebSocket.send('add_category', {
-        category: categoryName
-    });
-}
-
-function removeCategory(categoryName) {
-    if (!gameWebSocket) return;
-
-    gameWebSocket.send('delete_category', {
-        category: categoryName
-    });
-
-    const tags = document.querySelectorAll('.category-tag');
-    tags.forEach(tag => {
-        if (tag.textContent.includes(categoryName)) {
-            tag.remove();
-        }
-    });
-}
-
 let gameWebSocket = null;
 
 document.addEventListener('DOMContentLoaded', () => {
@@ -422,7 +612,8 @@ function setupChatForm() {
 
 function setupStartButton() {
     const startButton = document.getElementById('start-game-btn');
-    if (startButton) {
+    // Au petit bac le bouton valide le formulaire de configuration
+    if (startButton && !startButton.form) {
         startButton.addEventListener('click', (e) => {
             e.preventDefault();
             console.log('Clic sur demarrer');
@@ -444,8 +635,6 @@ function setupAnswerForms() {
             if (answer && gameWebSocket) {
                 submitBlindTestAnswer(gameWebSocket, answer);
                 document.getElementById('blindtest-answer').value = '';
-                blindtestForm.querySelector('input').disabled = true;
-                blindtestForm.querySelector('button').disabled = true;
             }
         });
     }
@@ -455,13 +644,10 @@ function setupAnswerForms() {
         petitbacForm.addEventListener('submit', (e) => {
             e.preventDefault();
             
-            const answers = {
-                artiste: document.getElementById('answer-artiste')?.value.trim() || '',
-                album: document.getElementById('answer-album')?.value.trim() || '',
-                groupe: document.getElementById('answer-groupe')?.value.trim() || '',
-                instrument: document.getElementById('answer-instrument')?.value.trim() || '',
-                featuring: document.getElementById('answer-featuring')?.value.trim() || ''
-            };
+            const answers = {};
+            petitbacForm.querySelectorAll('input[data-category]').forEach(input => {
+                answers[input.dataset.category] = input.value.trim();
+            });
 
             if (gameWebSocket) {
                 submitPetitBacAnswers(gameWebSocket, answers);
@@ -470,6 +656,25 @@ function setupAnswerForms() {
             }
         });
     }
+
+    const finishValidation = document.getElementById('finish-validation');
+    if (finishValidation) {
+        finishValidation.addEventListener('click', () => {
+            const myId = Number(document.body.dataset.userId);
+            const rejected = [];
+            document.querySelectorAll('#validation-grid .validation-answer.rejected').forEach(row => {
+                const userId = Number(row.dataset.userId);
+                if (userId !== myId) {
+                    rejected.push({ user_id: userId, category: row.dataset.category });
+                }
+            });
+
+            if (gameWebSocket) {
+                submitPetitBacVotes(gameWebSocket, rejected);
+                finishValidation.disabled = true;
+            }
+        });
+    }
 }
 
 function setupCategoryCRUD() {
@@ -533,12 +738,14 @@ function setupCategoryCRUD() {
                 return;
             }
 
+            const responseTime = Number(configForm.querySelector('[name="response_time"]').value);
+
             if (gameWebSocket) {
-                gameWebSocket.send('categories_selected', {
-                    categories: selectedCategories
+                startGame(gameWebSocket, {
+                    categories: selectedCategories,
+                    responseTime: responseTime
                 });
-                
-                startGame(gameWebSocket);
+                document.getElementById('start-game-btn').disabled = true;
                 console.log('Jeu demarre avec categories:', selectedCategories);
             }
         });
@@ -0,0 +1,946 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"groupie-tracker/achievement"
+	"groupie-tracker/admin"
+	"groupie-tracker/auth"
+	"groupie-tracker/game"
+	"groupie-tracker/rating"
+	"groupie-tracker/room"
+	"groupie-tracker/scoreboard"
+)
+
+// Donnees partagees par les stores en memoire : une salle doit connaitre le pseudo
+// de ses joueurs, une session son utilisateur, comme les jointures SQL.
+type memory struct {
+	mu sync.Mutex
+
+	nextID        int
+	users         map[int]*auth.User
+	deleted       map[int]bool
+	banReasons    map[int]string
+	sessions      map[string]*auth.Session // cle : empreinte du jeton
+	loginAttempts []memoryLoginAttempt
+	emailTokens   map[string]*memoryEmailToken // cle : empreinte du jeton
+	rooms         map[int]*room.Room
+	reports       []memoryReport
+}
+
+type memoryLoginAttempt struct {
+	ID         int
+	Identifier string
+	UserID     int
+	IPAddress  string
+	Success    bool
+	CreatedAt  time.Time
+}
+
+type memoryEmailToken struct {
+	UserID    int
+	Purpose   string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	Used      bool
+}
+
+type memoryReport struct {
+	ID         int
+	ReporterID int
+	ReportedID int
+	Reason     string
+	CreatedAt  time.Time
+	Resolved   bool
+}
+
+// Stores sans base de donnees, pour les tests. Les scores, les classements Elo
+// et les badges, tenus a jour par le moteur de jeu sur la base, restent vides.
+func NewMemory() *Stores {
+	m := &memory{
+		users:       make(map[int]*auth.User),
+		deleted:     make(map[int]bool),
+		banReasons:  make(map[int]string),
+		sessions:    make(map[string]*auth.Session),
+		emailTokens: make(map[string]*memoryEmailToken),
+		rooms:       make(map[int]*room.Room),
+	}
+
+	return &Stores{
+		Users:         memoryUsers{m},
+		Sessions:      memorySessions{m},
+		LoginAttempts: memoryLoginAttempts{m},
+		EmailTokens:   memoryEmailTokens{m},
+		Rooms:         memoryRooms{m},
+		Scores:        memoryScores{m},
+		Ratings:       memoryRatings{m},
+		Achievements:  memoryAchievements{},
+		Admin:         memoryAdmin{m},
+	}
+}
+
+func (m *memory) newID() int {
+	m.nextID++
+	return m.nextID
+}
+
+// Comme l'index unique sur pseudo_key : les comptes supprimes n'en ont plus
+func (m *memory) pseudoTaken(pseudo string, excludeUserID int) bool {
+	key := auth.PseudoKey(pseudo)
+	for id, user := range m.users {
+		if id != excludeUserID && !m.deleted[id] && auth.PseudoKey(user.Pseudo) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memory) emailTaken(email string, excludeUserID int) bool {
+	for id, user := range m.users {
+		if id != excludeUserID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// Les comptes supprimes (anonymises) ne sont plus retrouvables
+func (m *memory) findUser(match func(user *auth.User) bool) (*auth.User, error) {
+	for id, user := range m.users {
+		if !m.deleted[id] && match(user) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("utilisateur introuvable")
+}
+
+func (m *memory) user(id int) (*auth.User, error) {
+	user, ok := m.users[id]
+	if !ok || m.deleted[id] {
+		return nil, errors.New("utilisateur introuvable")
+	}
+	return user, nil
+}
+
+type memoryUsers struct{ m *memory }
+
+func (s memoryUsers) Create(pseudo string, email string, passwordHash string) (*auth.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.pseudoTaken(pseudo, 0) || s.m.emailTaken(email, 0) {
+		return nil, auth.ErrAccountTaken
+	}
+
+	user := &auth.User{
+		ID:           s.m.newID(),
+		Pseudo:       pseudo,
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         auth.RoleUser,
+		CreatedAt:    time.Now().UTC(),
+	}
+	s.m.users[user.ID] = user
+
+	copied := *user
+	return &copied, nil
+}
+
+func (s memoryUsers) CreateGuest(pseudo string) (*auth.User, error) {
+	if err := auth.ValidatePseudo(pseudo); err != nil {
+		return nil, err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.pseudoTaken(pseudo, 0) {
+		return nil, auth.ErrPseudoTaken
+	}
+
+	user := &auth.User{
+		ID:        s.m.newID(),
+		Pseudo:    pseudo,
+		IsGuest:   true,
+		Role:      auth.RoleUser,
+		CreatedAt: time.Now().UTC(),
+	}
+	user.Email = "invite-" + user.Pseudo + "@invalid"
+	s.m.users[user.ID] = user
+
+	copied := *user
+	return &copied, nil
+}
+
+func (s memoryUsers) GetByID(id int) (*auth.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	user, err := s.m.user(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s memoryUsers) GetByPseudo(pseudo string) (*auth.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.findUser(func(user *auth.User) bool { return user.Pseudo == pseudo })
+}
+
+func (s memoryUsers) GetByLogin(identifier string) (*auth.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.findUser(func(user *auth.User) bool { return user.Pseudo == identifier || user.Email == identifier })
+}
+
+func (s memoryUsers) GetByEmail(email string) (*auth.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.findUser(func(user *auth.User) bool { return user.Email == email })
+}
+
+func (s memoryUsers) CheckPseudoAvailable(pseudo string, excludeUserID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.pseudoTaken(pseudo, excludeUserID) {
+		return auth.ErrPseudoTaken
+	}
+	return nil
+}
+
+func (s memoryUsers) SetPseudo(userID int, pseudo string) error {
+	return s.update(userID, func(user *auth.User) error {
+		if s.m.pseudoTaken(pseudo, userID) {
+			return auth.ErrPseudoTaken
+		}
+		user.Pseudo = pseudo
+		return nil
+	})
+}
+
+func (s memoryUsers) SetPendingEmail(userID int, email string) error {
+	return s.update(userID, func(user *auth.User) error {
+		if s.m.emailTaken(email, userID) {
+			return auth.ErrEmailTaken
+		}
+		user.PendingEmail = email
+		return nil
+	})
+}
+
+func (s memoryUsers) ConfirmPendingEmail(userID int) error {
+	return s.update(userID, func(user *auth.User) error {
+		if user.PendingEmail == "" {
+			return auth.ErrInvalidEmailToken
+		}
+		if s.m.emailTaken(user.PendingEmail, userID) {
+			return auth.ErrEmailTaken
+		}
+		user.Email = user.PendingEmail
+		user.PendingEmail = ""
+		user.EmailVerified = true
+		return nil
+	})
+}
+
+func (s memoryUsers) MarkEmailVerified(userID int) error {
+	return s.update(userID, func(user *auth.User) error {
+		user.EmailVerified = true
+		return nil
+	})
+}
+
+func (s memoryUsers) SetPassword(userID int, passwordHash string) error {
+	return s.update(userID, func(user *auth.User) error {
+		user.PasswordHash = passwordHash
+		return nil
+	})
+}
+
+func (s memoryUsers) ResetPassword(userID int, passwordHash string) error {
+	return s.update(userID, func(user *auth.User) error {
+		user.PasswordHash = passwordHash
+		user.EmailVerified = true
+		s.m.deleteSessions(userID, 0)
+		return nil
+	})
+}
+
+func (s memoryUsers) ConvertGuest(userID int, email string, passwordHash string) error {
+	return s.update(userID, func(user *auth.User) error {
+		if !user.IsGuest {
+			return errors.New("ce compte n'est pas un compte invite")
+		}
+		if s.m.emailTaken(email, userID) {
+			return auth.ErrEmailTaken
+		}
+		user.Email = email
+		user.PasswordHash = passwordHash
+		user.IsGuest = false
+		user.EmailVerified = false
+		return nil
+	})
+}
+
+// Meme anonymisation que auth.DeleteAccount
+func (s memoryUsers) Delete(userID int) error {
+	return s.update(userID, func(user *auth.User) error {
+		user.Pseudo = fmt.Sprintf("Joueur supprime %d", userID)
+		user.Email = fmt.Sprintf("supprime-%d@invalid", userID)
+		user.PasswordHash = ""
+		user.EmailVerified = false
+		user.PendingEmail = ""
+		s.m.deleted[userID] = true
+
+		s.m.deleteSessions(userID, 0)
+		for hash, token := range s.m.emailTokens {
+			if token.UserID == userID {
+				delete(s.m.emailTokens, hash)
+			}
+		}
+		for i, attempt := range s.m.loginAttempts {
+			if attempt.UserID == userID {
+				s.m.loginAttempts[i] = memoryLoginAttempt{ID: attempt.ID, Success: attempt.Success, CreatedAt: attempt.CreatedAt}
+			}
+		}
+		return nil
+	})
+}
+
+func (s memoryUsers) update(userID int, change func(user *auth.User) error) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	user, err := s.m.user(userID)
+	if err != nil {
+		return err
+	}
+	return change(user)
+}
+
+type memorySessions struct{ m *memory }
+
+func (s memorySessions) Create(userID int, userAgent string, ipAddress string, rememberMe bool) (string, error) {
+	return s.create(userID, userAgent, ipAddress, auth.Session{RememberMe: rememberMe})
+}
+
+func (s memorySessions) CreateGuest(userID int, userAgent string, ipAddress string) (string, error) {
+	return s.create(userID, userAgent, ipAddress, auth.Session{Guest: true})
+}
+
+func (s memorySessions) create(userID int, userAgent string, ipAddress string, session auth.Session) (string, error) {
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[userID]; !ok {
+		return "", errors.New("utilisateur introuvable")
+	}
+
+	now := time.Now().UTC()
+	session.ID = s.m.newID()
+	session.UserID = userID
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(session.Duration())
+	session.UserAgent = userAgent
+	session.IPAddress = ipAddress
+	s.m.sessions[auth.HashSessionToken(token)] = &session
+
+	return token, nil
+}
+
+func (s memorySessions) Validate(token string) (*auth.User, *auth.Session, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	hash := auth.HashSessionToken(token)
+	session, ok := s.m.sessions[hash]
+	if !ok {
+		return nil, nil, errors.New("session invalide")
+	}
+	user, ok := s.m.users[session.UserID]
+	if !ok || user.Banned {
+		return nil, nil, errors.New("session invalide")
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		delete(s.m.sessions, hash)
+		return nil, nil, errors.New("session expiree")
+	}
+
+	copiedUser := *user
+	copiedSession := *session
+	copiedSession.Guest = user.IsGuest
+	return &copiedUser, &copiedSession, nil
+}
+
+func (s memorySessions) Touch(session *auth.Session, ipAddress string) (bool, error) {
+	if !session.Extend(ipAddress) {
+		return false, nil
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, stored := range s.m.sessions {
+		if stored.ID == session.ID {
+			stored.LastSeenAt = session.LastSeenAt
+			stored.ExpiresAt = session.ExpiresAt
+			stored.IPAddress = session.IPAddress
+		}
+	}
+	return true, nil
+}
+
+func (s memorySessions) Delete(token string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.sessions, auth.HashSessionToken(token))
+	return nil
+}
+
+func (s memorySessions) ListForUser(userID int) ([]auth.Session, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var sessions []auth.Session
+	for _, session := range s.m.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s memorySessions) DeleteForUser(userID int, sessionID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for hash, session := range s.m.sessions {
+		if session.ID == sessionID && session.UserID == userID {
+			delete(s.m.sessions, hash)
+			return nil
+		}
+	}
+	return errors.New("session introuvable")
+}
+
+func (s memorySessions) DeleteOthers(userID int, keepSessionID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.deleteSessions(userID, keepSessionID)
+	return nil
+}
+
+// keepSessionID vaut 0 pour fermer toutes les sessions
+func (m *memory) deleteSessions(userID int, keepSessionID int) {
+	for hash, session := range m.sessions {
+		if session.UserID == userID && session.ID != keepSessionID {
+			delete(m.sessions, hash)
+		}
+	}
+}
+
+type memoryLoginAttempts struct{ m *memory }
+
+func (s memoryLoginAttempts) Record(identifier string, userID int, ipAddress string, success bool) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.loginAttempts = append(s.m.loginAttempts, memoryLoginAttempt{
+		ID:         s.m.newID(),
+		Identifier: strings.ToLower(strings.TrimSpace(identifier)),
+		UserID:     userID,
+		IPAddress:  ipAddress,
+		Success:    success,
+		CreatedAt:  time.Now().UTC(),
+	})
+	return nil
+}
+
+func (s memoryLoginAttempts) AccountFailures(identifier string, userID int, since time.Time) (auth.LoginFailures, error) {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	return s.failures(func(attempt memoryLoginAttempt) bool {
+		if userID != 0 {
+			return attempt.UserID == userID
+		}
+		return attempt.Identifier == identifier
+	}, since, true), nil
+}
+
+func (s memoryLoginAttempts) IPFailures(ipAddress string, since time.Time) (auth.LoginFailures, error) {
+	return s.failures(func(attempt memoryLoginAttempt) bool {
+		return attempt.IPAddress == ipAddress
+	}, since, false), nil
+}
+
+// Les tentatives sont rangees par ordre d'enregistrement
+func (s memoryLoginAttempts) failures(match func(attempt memoryLoginAttempt) bool, since time.Time, resetOnSuccess bool) auth.LoginFailures {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var failures auth.LoginFailures
+	for _, attempt := range s.m.loginAttempts {
+		if !match(attempt) {
+			continue
+		}
+		if attempt.Success {
+			if resetOnSuccess {
+				failures = auth.LoginFailures{}
+			}
+			continue
+		}
+		if !attempt.CreatedAt.Before(since) {
+			failures.Count++
+			failures.Last = attempt.CreatedAt
+		}
+	}
+	return failures
+}
+
+type memoryEmailTokens struct{ m *memory }
+
+func (s memoryEmailTokens) Create(userID int, purpose string, duration time.Duration) (string, error) {
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, existing := range s.m.emailTokens {
+		if existing.UserID == userID && existing.Purpose == purpose {
+			existing.Used = true
+		}
+	}
+
+	now := time.Now().UTC()
+	s.m.emailTokens[auth.HashSessionToken(token)] = &memoryEmailToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(duration),
+		CreatedAt: now,
+	}
+	return token, nil
+}
+
+func (s memoryEmailTokens) Consume(token string, purpose string) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.emailTokens[auth.HashSessionToken(token)]
+	if !ok || stored.Purpose != purpose || stored.Used || time.Now().After(stored.ExpiresAt) {
+		return 0, auth.ErrInvalidEmailToken
+	}
+	stored.Used = true
+	return stored.UserID, nil
+}
+
+func (s memoryEmailTokens) Check(token string, purpose string) bool {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.emailTokens[auth.HashSessionToken(token)]
+	return ok && stored.Purpose == purpose && !stored.Used && time.Now().Before(stored.ExpiresAt)
+}
+
+func (s memoryEmailTokens) CreatedSince(userID int, purpose string, since time.Time) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, stored := range s.m.emailTokens {
+		if stored.UserID == userID && stored.Purpose == purpose && stored.CreatedAt.After(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryRooms struct{ m *memory }
+
+func (s memoryRooms) Create(gameType string, hostID int, isPublic bool) (*room.Room, error) {
+	if gameType != "blindtest" && gameType != "petitbac" {
+		return nil, room.ErrInvalidGameType
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	host, ok := s.m.users[hostID]
+	if !ok {
+		return nil, errors.New("utilisateur introuvable")
+	}
+
+	code, err := room.GenerateRoomCode()
+	if err != nil {
+		return nil, err
+	}
+	for attempts := 1; s.m.roomByCode(code) != nil; attempts++ {
+		if attempts == 5 {
+			return nil, room.ErrNoRoomCode
+		}
+		if code, err = room.GenerateRoomCode(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	created := &room.Room{
+		ID:         s.m.newID(),
+		Code:       code,
+		GameType:   gameType,
+		HostID:     hostID,
+		MaxPlayers: room.MaxPlayers,
+		IsPublic:   isPublic,
+		Status:     "waiting",
+		CreatedAt:  now,
+		Players:    []room.Player{{UserID: hostID, Pseudo: host.Pseudo, JoinedAt: now}},
+	}
+	s.m.rooms[created.ID] = created
+
+	return copyRoom(created), nil
+}
+
+func (s memoryRooms) GetByCode(code string) (*room.Room, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	found := s.m.roomByCode(code)
+	if found == nil {
+		return nil, room.ErrRoomNotFound
+	}
+	return copyRoom(found), nil
+}
+
+func (s memoryRooms) Join(code string, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	found := s.m.roomByCode(code)
+	if found == nil {
+		return room.ErrRoomNotFound
+	}
+	user, ok := s.m.users[userID]
+	if !ok {
+		return errors.New("utilisateur introuvable")
+	}
+	for _, player := range found.Players {
+		if player.UserID == userID {
+			return room.ErrAlreadyJoined
+		}
+	}
+	if found.Status != "waiting" {
+		return room.ErrGameAlreadyStarted
+	}
+	if len(found.Players) >= found.MaxPlayers {
+		return room.ErrRoomFull
+	}
+
+	found.Players = append(found.Players, room.Player{UserID: userID, Pseudo: user.Pseudo, JoinedAt: time.Now().UTC()})
+	return nil
+}
+
+func (m *memory) roomByCode(code string) *room.Room {
+	for _, r := range m.rooms {
+		if r.Code == code {
+			return r
+		}
+	}
+	return nil
+}
+
+func copyRoom(r *room.Room) *room.Room {
+	copied := *r
+	copied.Players = append([]room.Player(nil), r.Players...)
+	return &copied
+}
+
+type memoryScores struct{ m *memory }
+
+func (s memoryScores) PlayerStats(pseudo string) (*scoreboard.PlayerStats, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, user := range s.m.users {
+		if user.Pseudo == pseudo && !user.IsGuest {
+			return &scoreboard.PlayerStats{
+				UserID: user.ID,
+				Pseudo: user.Pseudo,
+				ByGameType: map[string]*scoreboard.GameTypeStats{
+					"blindtest": {GameType: "blindtest"},
+					"petitbac":  {GameType: "petitbac"},
+				},
+			}, nil
+		}
+	}
+	return nil, errors.New("joueur introuvable")
+}
+
+func (s memoryScores) Leaderboard(days int, limit int) ([]scoreboard.LeaderboardEntry, error) {
+	return nil, nil
+}
+
+func (s memoryScores) BlindTestRecap(roomID int) ([]game.BlindTestRecapEntry, error) {
+	return nil, nil
+}
+
+type memoryRatings struct{ m *memory }
+
+func (s memoryRatings) ForUser(userID int) (map[string]rating.Rating, error) {
+	return map[string]rating.Rating{
+		"blindtest": {UserID: userID, GameType: "blindtest", Rating: rating.DefaultRating},
+		"petitbac":  {UserID: userID, GameType: "petitbac", Rating: rating.DefaultRating},
+	}, nil
+}
+
+func (s memoryRatings) History(userID int, limit int) ([]rating.HistoryEntry, error) {
+	return nil, nil
+}
+
+// Tous les joueurs ont le classement initial : les salles les plus recentes d'abord
+func (s memoryRatings) SuggestRooms(userID int, limit int) ([]rating.SuggestedRoom, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var candidates []*room.Room
+	for _, r := range s.m.rooms {
+		if r.Status != "waiting" || !r.IsPublic || len(r.Players) >= r.MaxPlayers {
+			continue
+		}
+		joined := false
+		for _, player := range r.Players {
+			joined = joined || player.UserID == userID
+		}
+		if !joined {
+			candidates = append(candidates, r)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].CreatedAt.Equal(candidates[j].CreatedAt) {
+			return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+		}
+		return candidates[i].ID > candidates[j].ID
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	var suggestions []rating.SuggestedRoom
+	for _, r := range candidates {
+		suggestions = append(suggestions, rating.SuggestedRoom{
+			Code:       r.Code,
+			GameType:   r.GameType,
+			NbPlayers:  len(r.Players),
+			MaxPlayers: r.MaxPlayers,
+			AvgRating:  rating.DefaultRating,
+		})
+	}
+	return suggestions, nil
+}
+
+type memoryAchievements struct{}
+
+func (memoryAchievements) ForUser(userID int) ([]achievement.UnlockedAchievement, error) {
+	return nil, nil
+}
+
+func (memoryAchievements) ForRoom(roomID int) (map[int][]achievement.Achievement, error) {
+	return make(map[int][]achievement.Achievement), nil
+}
+
+type memoryAdmin struct{ m *memory }
+
+func (s memoryAdmin) ListUsers(search string, limit int) ([]admin.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	search = strings.ToLower(search)
+	var users []admin.User
+	for id, user := range s.m.users {
+		if s.m.deleted[id] {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(user.Pseudo), search) && !strings.Contains(strings.ToLower(user.Email), search) {
+			continue
+		}
+		users = append(users, admin.User{
+			ID:        user.ID,
+			Pseudo:    user.Pseudo,
+			Email:     user.Email,
+			Role:      user.Role,
+			IsGuest:   user.IsGuest,
+			Banned:    user.Banned,
+			BanReason: s.m.banReasons[id],
+			CreatedAt: user.CreatedAt,
+		})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.After(users[j].CreatedAt)
+		}
+		return users[i].ID > users[j].ID
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (s memoryAdmin) UserRole(userID int) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	user, err := s.m.user(userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+func (s memoryAdmin) Ban(userID int, reason string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	user, err := s.m.user(userID)
+	if err != nil {
+		return err
+	}
+	user.Banned = true
+	s.m.banReasons[userID] = admin.TruncateReason(reason)
+	s.m.deleteSessions(userID, 0)
+	return nil
+}
+
+func (s memoryAdmin) Unban(userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if user, ok := s.m.users[userID]; ok {
+		user.Banned = false
+		delete(s.m.banReasons, userID)
+	}
+	return nil
+}
+
+func (s memoryAdmin) SetRole(userID int, role string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	user, err := s.m.user(userID)
+	if err != nil || user.IsGuest {
+		return errors.New("utilisateur introuvable")
+	}
+	user.Role = role
+	return nil
+}
+
+func (s memoryAdmin) CreateReport(reporterID int, reportedID int, reason string) error {
+	reason, err := admin.CheckReport(reporterID, reportedID, reason)
+	if err != nil {
+		return err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[reporterID]; !ok {
+		return errors.New("utilisateur introuvable")
+	}
+	if _, ok := s.m.users[reportedID]; !ok {
+		return errors.New("utilisateur introuvable")
+	}
+
+	s.m.reports = append(s.m.reports, memoryReport{
+		ID:         s.m.newID(),
+		ReporterID: reporterID,
+		ReportedID: reportedID,
+		Reason:     reason,
+		CreatedAt:  time.Now().UTC(),
+	})
+	return nil
+}
+
+// Les signalements non traites d'abord, puis les plus recents
+func (s memoryAdmin) RecentReports(limit int) ([]admin.Report, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var reports []admin.Report
+	for i := len(s.m.reports) - 1; i >= 0; i-- {
+		report := s.m.reports[i]
+		reports = append(reports, admin.Report{
+			ID:             report.ID,
+			ReporterPseudo: s.m.users[report.ReporterID].Pseudo,
+			ReportedID:     report.ReportedID,
+			ReportedPseudo: s.m.users[report.ReportedID].Pseudo,
+			Reason:         report.Reason,
+			CreatedAt:      report.CreatedAt,
+			Resolved:       report.Resolved,
+		})
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return !reports[i].Resolved && reports[j].Resolved
+	})
+	if len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
+
+func (s memoryAdmin) ResolveReport(reportID int, resolvedBy int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i := range s.m.reports {
+		if s.m.reports[i].ID == reportID {
+			s.m.reports[i].Resolved = true
+		}
+	}
+	return nil
+}
+
+func (s memoryAdmin) RoomsInfo(roomIDs []int) (map[int]admin.RoomInfo, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	rooms := make(map[int]admin.RoomInfo)
+	for _, roomID := range roomIDs {
+		r, ok := s.m.rooms[roomID]
+		if !ok {
+			return nil, room.ErrRoomNotFound
+		}
+		rooms[roomID] = admin.RoomInfo{
+			ID:       r.ID,
+			Code:     r.Code,
+			GameType: r.GameType,
+			Status:   r.Status,
+			Host:     s.m.users[r.HostID].Pseudo,
+		}
+	}
+	return rooms, nil
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"groupie-tracker/auth"
+)
+
+// Comme l'index unique sur pseudo_key : deux pseudos trop ressemblants ne
+// peuvent pas coexister, meme en passant directement par Create
+func TestMemoryUsersCreateUsesPseudoKey(t *testing.T) {
+	users := NewMemory().Users
+
+	alice, err := users.Create("Alice", "alice@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pseudo := range []string{"Alice", "ALICE", "A1ice", "alice"} {
+		if _, err := users.Create(pseudo, pseudo+"@example.org", ""); !errors.Is(err, auth.ErrAccountTaken) {
+			t.Errorf("Create(%q) = %v, attendu %v", pseudo, err, auth.ErrAccountTaken)
+		}
+	}
+
+	if err := users.Delete(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Create("alice", "alice2@example.com", ""); err != nil {
+		t.Errorf("pseudo d'un compte supprime non libere: %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"groupie-tracker/achievement"
+	"groupie-tracker/admin"
+	"groupie-tracker/auth"
+	"groupie-tracker/database"
+	"groupie-tracker/game"
+	"groupie-tracker/rating"
+	"groupie-tracker/room"
+	"groupie-tracker/scoreboard"
+)
+
+func NewSQL(db *sql.DB) *Stores {
+	return &Stores{
+		Users:         sqlUsers{db},
+		Sessions:      sqlSessions{db},
+		LoginAttempts: sqlLoginAttempts{db},
+		EmailTokens:   sqlEmailTokens{db},
+		Rooms:         sqlRooms{db},
+		Scores:        sqlScores{db},
+		Ratings:       sqlRatings{db},
+		Achievements:  sqlAchievements{db},
+		Admin:         sqlAdmin{db},
+	}
+}
+
+type sqlUsers struct{ db *sql.DB }
+
+func (s sqlUsers) Create(pseudo string, email string, passwordHash string) (*auth.User, error) {
+	result, err := s.db.Exec(
+		"INSERT INTO users (pseudo, pseudo_key, email, password_hash) VALUES (?, ?, ?, ?)",
+		pseudo, auth.PseudoKey(pseudo), email, passwordHash,
+	)
+	if database.IsUniqueViolation(err) {
+		return nil, auth.ErrAccountTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(int(userID))
+}
+
+func (s sqlUsers) CreateGuest(pseudo string) (*auth.User, error) {
+	return auth.CreateGuest(s.db, pseudo)
+}
+
+func (s sqlUsers) GetByID(id int) (*auth.User, error) {
+	return s.get("id = ?", id)
+}
+
+func (s sqlUsers) GetByPseudo(pseudo string) (*auth.User, error) {
+	return s.get("pseudo = ?", pseudo)
+}
+
+func (s sqlUsers) GetByLogin(identifier string) (*auth.User, error) {
+	return s.get("(pseudo = ? OR email = ?)", identifier, identifier)
+}
+
+func (s sqlUsers) GetByEmail(email string) (*auth.User, error) {
+	return s.get("email = ?", email)
+}
+
+// Les comptes supprimes (anonymises) ne sont plus retrouvables
+func (s sqlUsers) get(where string, args ...interface{}) (*auth.User, error) {
+	var user auth.User
+	err := s.db.QueryRow(`
+		SELECT id, pseudo, email, password_hash, is_guest, role, created_at,
+			email_verified, COALESCE(pending_email, ''), banned_at IS NOT NULL
+		FROM users
+		WHERE deleted_at IS NULL AND `+where, args...).Scan(&user.ID, &user.Pseudo, &user.Email, &user.PasswordHash, &user.IsGuest, &user.Role, &user.CreatedAt,
+		&user.EmailVerified, &user.PendingEmail, &user.Banned)
+	if err != nil {
+		return nil, errors.New("utilisateur introuvable")
+	}
+	return &user, nil
+}
+
+func (s sqlUsers) CheckPseudoAvailable(pseudo string, excludeUserID int) error {
+	return auth.CheckPseudoAvailable(s.db, pseudo, excludeUserID)
+}
+
+func (s sqlUsers) SetPseudo(userID int, pseudo string) error {
+	_, err := s.db.Exec("UPDATE users SET pseudo = ?, pseudo_key = ? WHERE id = ?", pseudo, auth.PseudoKey(pseudo), userID)
+	if database.IsUniqueViolation(err) {
+		return auth.ErrPseudoTaken
+	}
+	return err
+}
+
+func (s sqlUsers) SetPendingEmail(userID int, email string) error {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? AND id != ?", email, userID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return auth.ErrEmailTaken
+	}
+
+	_, err = s.db.Exec("UPDATE users SET pending_email = ? WHERE id = ?", email, userID)
+	return err
+}
+
+func (s sqlUsers) ConfirmPendingEmail(userID int) error {
+	result, err := s.db.Exec(`
+		UPDATE users SET email = pending_email, pending_email = NULL, email_verified = 1
+		WHERE id = ? AND pending_email IS NOT NULL
+	`, userID)
+	// L'adresse a pu etre prise par un autre compte entre temps
+	if database.IsUniqueViolation(err) {
+		return auth.ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return auth.ErrInvalidEmailToken
+	}
+	return nil
+}
+
+func (s sqlUsers) MarkEmailVerified(userID int) error {
+	return auth.MarkEmailVerified(s.db, userID)
+}
+
+func (s sqlUsers) SetPassword(userID int, passwordHash string) error {
+	_, err := s.db.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID)
+	return err
+}
+
+func (s sqlUsers) ResetPassword(userID int, passwordHash string) error {
+	return auth.ResetPassword(s.db, userID, passwordHash)
+}
+
+func (s sqlUsers) ConvertGuest(userID int, email string, passwordHash string) error {
+	return auth.ConvertGuest(s.db, userID, email, passwordHash)
+}
+
+func (s sqlUsers) Delete(userID int) error {
+	return auth.DeleteAccount(s.db, userID)
+}
+
+type sqlSessions struct{ db *sql.DB }
+
+func (s sqlSessions) Create(userID int, userAgent string, ipAddress string, rememberMe bool) (string, error) {
+	return auth.CreateSession(s.db, userID, userAgent, ipAddress, rememberMe)
+}
+
+func (s sqlSessions) CreateGuest(userID int, userAgent string, ipAddress string) (string, error) {
+	return auth.CreateGuestSession(s.db, userID, userAgent, ipAddress)
+}
+
+func (s sqlSessions) Validate(token string) (*auth.User, *auth.Session, error) {
+	return auth.ValidateSession(s.db, token)
+}
+
+func (s sqlSessions) Touch(session *auth.Session, ipAddress string) (bool, error) {
+	return auth.TouchSession(s.db, session, ipAddress)
+}
+
+func (s sqlSessions) Delete(token string) error {
+	return auth.DeleteSession(s.db, token)
+}
+
+func (s sqlSessions) ListForUser(userID int) ([]auth.Session, error) {
+	return auth.GetUserSessions(s.db, userID)
+}
+
+func (s sqlSessions) DeleteForUser(userID int, sessionID int) error {
+	return auth.DeleteUserSession(s.db, userID, sessionID)
+}
+
+func (s sqlSessions) DeleteOthers(userID int, keepSessionID int) error {
+	return auth.DeleteOtherSessions(s.db, userID, keepSessionID)
+}
+
+type sqlLoginAttempts struct{ db *sql.DB }
+
+func (s sqlLoginAttempts) Record(identifier string, userID int, ipAddress string, success bool) error {
+	return auth.RecordLoginAttempt(s.db, identifier, userID, ipAddress, success)
+}
+
+func (s sqlLoginAttempts) AccountFailures(identifier string, userID int, since time.Time) (auth.LoginFailures, error) {
+	return auth.AccountLoginFailures(s.db, identifier, userID, since)
+}
+
+func (s sqlLoginAttempts) IPFailures(ipAddress string, since time.Time) (auth.LoginFailures, error) {
+	return auth.IPLoginFailures(s.db, ipAddress, since)
+}
+
+type sqlEmailTokens struct{ db *sql.DB }
+
+func (s sqlEmailTokens) Create(userID int, purpose string, duration time.Duration) (string, error) {
+	return auth.CreateEmailToken(s.db, userID, purpose, duration)
+}
+
+func (s sqlEmailTokens) Consume(token string, purpose string) (int, error) {
+	return auth.ConsumeEmailToken(s.db, token, purpose)
+}
+
+func (s sqlEmailTokens) Check(token string, purpose string) bool {
+	return auth.CheckEmailToken(s.db, token, purpose)
+}
+
+func (s sqlEmailTokens) CreatedSince(userID int, purpose string, since time.Time) (bool, error) {
+	return auth.EmailTokenCreatedSince(s.db, userID, purpose, since)
+}
+
+type sqlRooms struct{ db *sql.DB }
+
+func (s sqlRooms) Create(gameType string, hostID int, isPublic bool) (*room.Room, error) {
+	return room.CreateRoom(s.db, gameType, hostID, isPublic)
+}
+
+func (s sqlRooms) GetByCode(code string) (*room.Room, error) {
+	return room.GetRoomByCode(s.db, code)
+}
+
+func (s sqlRooms) Join(code string, userID int) error {
+	return room.JoinRoom(s.db, code, userID)
+}
+
+type sqlScores struct{ db *sql.DB }
+
+func (s sqlScores) PlayerStats(pseudo string) (*scoreboard.PlayerStats, error) {
+	return scoreboard.GetPlayerStats(s.db, pseudo)
+}
+
+func (s sqlScores) Leaderboard(days int, limit int) ([]scoreboard.LeaderboardEntry, error) {
+	return scoreboard.GetLeaderboard(s.db, days, limit)
+}
+
+func (s sqlScores) BlindTestRecap(roomID int) ([]game.BlindTestRecapEntry, error) {
+	return game.GetBlindTestRecap(s.db, roomID)
+}
+
+type sqlRatings struct{ db *sql.DB }
+
+func (s sqlRatings) ForUser(userID int) (map[string]rating.Rating, error) {
+	return rating.GetUserRatings(s.db, userID)
+}
+
+func (s sqlRatings) History(userID int, limit int) ([]rating.HistoryEntry, error) {
+	return rating.GetRatingHistory(s.db, userID, limit)
+}
+
+func (s sqlRatings) SuggestRooms(userID int, limit int) ([]rating.SuggestedRoom, error) {
+	return rating.SuggestRooms(s.db, userID, limit)
+}
+
+type sqlAchievements struct{ db *sql.DB }
+
+func (s sqlAchievements) ForUser(userID int) ([]achievement.UnlockedAchievement, error) {
+	return achievement.GetUserAchievements(s.db, userID)
+}
+
+func (s sqlAchievements) ForRoom(roomID int) (map[int][]achievement.Achievement, error) {
+	return achievement.GetRoomAchievements(s.db, roomID)
+}
+
+type sqlAdmin struct{ db *sql.DB }
+
+func (s sqlAdmin) ListUsers(search string, limit int) ([]admin.User, error) {
+	return admin.ListUsers(s.db, search, limit)
+}
+
+func (s sqlAdmin) UserRole(userID int) (string, error) {
+	return admin.GetUserRole(s.db, userID)
+}
+
+func (s sqlAdmin) Ban(userID int, reason string) error {
+	return admin.BanUser(s.db, userID, reason)
+}
+
+func (s sqlAdmin) Unban(userID int) error {
+	return admin.UnbanUser(s.db, userID)
+}
+
+func (s sqlAdmin) SetRole(userID int, role string) error {
+	return admin.SetRole(s.db, userID, role)
+}
+
+func (s sqlAdmin) CreateReport(reporterID int, reportedID int, reason string) error {
+	return admin.CreateReport(s.db, reporterID, reportedID, reason)
+}
+
+func (s sqlAdmin) RecentReports(limit int) ([]admin.Report, error) {
+	return admin.GetRecentReports(s.db, limit)
+}
+
+func (s sqlAdmin) ResolveReport(reportID int, resolvedBy int) error {
+	return admin.ResolveReport(s.db, reportID, resolvedBy)
+}
+
+func (s sqlAdmin) RoomsInfo(roomIDs []int) (map[int]admin.RoomInfo, error) {
+	return admin.GetRoomsInfo(s.db, roomIDs)
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"groupie-tracker/achievement"
+	"groupie-tracker/admin"
+	"groupie-tracker/auth"
+	"groupie-tracker/game"
+	"groupie-tracker/rating"
+	"groupie-tracker/room"
+	"groupie-tracker/scoreboard"
+)
+
+// Acces aux donnees utilises par les handlers HTTP. NewSQL branche les
+// fonctions des paquets auth, room, game, scoreboard, rating, achievement et
+// admin sur la base (SQLite, ou PostgreSQL via database.OpenDB) ; NewMemory
+// garde tout en memoire pour tester les handlers sans fichier. Le hub WebSocket
+// et les moteurs de jeu, qui ecrivent les manches et les scores, utilisent
+// directement la base.
+
+// Les methodes utilisees par les handlers de compte sont decrites par auth.UserStore
+type UserStore interface {
+	auth.UserStore
+	CreateGuest(pseudo string) (*auth.User, error)
+	GetByPseudo(pseudo string) (*auth.User, error)
+}
+
+// Les jetons manipules ici sont les jetons en clair du cookie
+type SessionStore interface {
+	auth.SessionStore
+	auth.SessionValidator
+	CreateGuest(userID int, userAgent string, ipAddress string) (string, error)
+}
+
+type RoomStore interface {
+	Create(gameType string, hostID int, isPublic bool) (*room.Room, error)
+	GetByCode(code string) (*room.Room, error)
+	Join(code string, userID int) error
+}
+
+type ScoreStore interface {
+	PlayerStats(pseudo string) (*scoreboard.PlayerStats, error)
+	Leaderboard(days int, limit int) ([]scoreboard.LeaderboardEntry, error)
+	BlindTestRecap(roomID int) ([]game.BlindTestRecapEntry, error)
+}
+
+// Les classements sont mis a jour par le moteur de jeu en fin de partie
+type RatingStore interface {
+	ForUser(userID int) (map[string]rating.Rating, error)
+	History(userID int, limit int) ([]rating.HistoryEntry, error)
+	SuggestRooms(userID int, limit int) ([]rating.SuggestedRoom, error)
+}
+
+// Les badges sont debloques par le moteur de jeu (achievement.Evaluate)
+type AchievementStore interface {
+	ForUser(userID int) ([]achievement.UnlockedAchievement, error)
+	ForRoom(roomID int) (map[int][]achievement.Achievement, error)
+}
+
+type AdminStore interface {
+	ListUsers(search string, limit int) ([]admin.User, error)
+	UserRole(userID int) (string, error)
+	Ban(userID int, reason string) error
+	Unban(userID int) error
+	SetRole(userID int, role string) error
+	CreateReport(reporterID int, reportedID int, reason string) error
+	RecentReports(limit int) ([]admin.Report, error)
+	ResolveReport(reportID int, resolvedBy int) error
+	RoomsInfo(roomIDs []int) (map[int]admin.RoomInfo, error)
+}
+
+type Stores struct {
+	Users         UserStore
+	Sessions      SessionStore
+	LoginAttempts auth.LoginAttemptStore
+	EmailTokens   auth.EmailTokenStore
+	Rooms         RoomStore
+	Scores        ScoreStore
+	Ratings       RatingStore
+	Achievements  AchievementStore
+	Admin         AdminStore
+}
+
+func (s *Stores) Accounts() auth.Accounts {
+	return auth.Accounts{
+		Users:         s.Users,
+		Sessions:      s.Sessions,
+		LoginAttempts: s.LoginAttempts,
+		EmailTokens:   s.EmailTokens,
+	}
+}